@@ -0,0 +1,521 @@
+package fabric
+
+import (
+	"fmt"
+	"sort"
+)
+
+/*
+	Abort Chains
+
+	When a dependency aborts, every node that (transitively) depends on it
+	can no longer rely on the dependency's work: the "Abort Chain/Tree" of
+	the Signal documentation. AbortChain propagates an Aborted (or
+	PartialAbort) value from a node through all of its transitive
+	dependents, and calls the Rollback method of every access procedure of
+	each node it aborts (dependents before their dependencies).
+
+	The value is also sent to the dependents that are blocked on an aborted
+	node (recorded as Waiting, see Block), on the channels the graph's
+	SignalBackend created for its edges, in the order of the chain. A
+	blocked node of the chain forwards the abort to its own dependents once
+	it receives it, and the Executor and Block do not send a final signal
+	for a node the chain already signaled for.
+
+	Nodes that have already completed are not rolled back, as their
+	operation has already been committed; they are listed in the report so
+	that the caller can decide how to compensate for them. Nodes that have
+	already aborted are not rolled back a second time.
+
+	Node State
+
+	To know which nodes have completed, Graph and VDG keep the last state
+	(Signal value) of every node: the Executor, Block and TotalBlock record
+	it as nodes execute, and SetState can be used by nodes that drive their
+	own signaling. A node without a recorded state is treated as Waiting.
+*/
+
+// AbortReport is the result of propagating an abort through a dependency graph
+type AbortReport struct {
+	Origin    int           // the node the abort started from
+	Value     Signal        // Aborted or PartialAbort
+	Aborted   []int         // nodes that were aborted by the chain, including the origin (sorted)
+	Completed []int         // dependents that had already completed, and were left untouched (sorted)
+	Errors    map[int]error // errors returned by Rollback, keyed by node id
+}
+
+// Err returns an error summarizing the failed rollbacks, or nil if every rollback succeeded
+func (r *AbortReport) Err() error {
+	if len(r.Errors) == 0 {
+		return nil
+	}
+
+	ids := make([]int, 0, len(r.Errors))
+	for id := range r.Errors {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+
+	return fmt.Errorf("Rollback failed for nodes %v: %v", ids, r.Errors[ids[0]])
+}
+
+// SetState records the state of the node with the given id
+func (g *Graph) SetState(id int, s Signal) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if _, ok := g.nodes[id]; !ok {
+		return fmt.Errorf("Node %d does not exist in Dependency Graph.", id)
+	}
+	g.setState(id, s)
+
+	return nil
+}
+
+// setState must be called with the write lock held
+func (g *Graph) setState(id int, s Signal) {
+	if g.states == nil {
+		g.states = make(map[int]Signal)
+	}
+	g.states[id] = s
+	if s == Waiting {
+		// a new run: the node signals for itself again
+		delete(g.signaled, id)
+	}
+	if s == Started {
+		// the node is about to operate on its section (see restoreLists)
+		if g.images == nil {
+			g.images = make(map[int]image)
+		}
+		g.images[id] = imageOf(g.nodes[id])
+	}
+}
+
+// recordState records the state of a node if it is (still) in the graph
+func (g *Graph) recordState(id int, s Signal) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if _, ok := g.nodes[id]; ok {
+		g.setState(id, s)
+	}
+}
+
+// finish sends the final signal of a node to its dependents, and only then
+// records it as the node's state; the node counts as sending until then, and
+// sends nothing if an abort chain already signaled for it (see AbortChain)
+func (g *Graph) finish(n DGNode, s Signal) {
+	g.mu.Lock()
+	if g.signaled[n.ID()] {
+		delete(g.signaled, n.ID())
+		g.mu.Unlock()
+		return
+	}
+	if g.sending == nil {
+		g.sending = make(map[int]int)
+	}
+	g.sending[n.ID()]++
+	g.mu.Unlock()
+
+	n.Signal(nodeSignal(n, s))
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.sending[n.ID()]--; g.sending[n.ID()] == 0 {
+		delete(g.sending, n.ID())
+	}
+	if _, ok := g.nodes[n.ID()]; ok {
+		g.setState(n.ID(), s)
+	}
+}
+
+// markSignaled records that an abort chain sent the final signal of a node;
+// must be called with the lock held
+func (g *Graph) markSignaled(id int) {
+	if g.signaled == nil {
+		g.signaled = make(map[int]bool)
+	}
+	g.signaled[id] = true
+}
+
+// forget drops everything recorded about a removed node; must be called
+// with the lock held
+func (g *Graph) forget(id int) {
+	delete(g.states, id)
+	delete(g.images, id)
+	delete(g.signaled, id)
+}
+
+// State returns the last recorded state of the node with the given id
+// (Waiting if none was recorded); false if the node is not in the graph
+func (g *Graph) State(id int) (Signal, bool) {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	if _, ok := g.nodes[id]; !ok {
+		return Waiting, false
+	}
+
+	return g.states[id], true
+}
+
+// AbortChain propagates an Aborted or PartialAbort value from the node with
+// the given id through all of its transitive dependents, rolling back every
+// node it aborts (the rollbacks run after the signals were delivered)
+func (g *Graph) AbortChain(id int, value Signal) (*AbortReport, error) {
+	if value != Aborted && value != PartialAbort {
+		return nil, fmt.Errorf("Abort chains can only propagate Aborted or PartialAbort signals.")
+	}
+
+	// the chain is computed under the lock, but rollbacks are run without it
+	g.mu.Lock()
+	if _, ok := g.nodes[id]; !ok {
+		g.mu.Unlock()
+		return nil, fmt.Errorf("Node %d does not exist in Dependency Graph.", id)
+	}
+	report := &AbortReport{Origin: id, Value: value, Errors: make(map[int]error)}
+	var rollback []DGNode
+	var sends []send
+	pre := make(map[int]image)
+	chain := g.adj.chain(id)
+	prior := make(map[int]Signal, len(chain))
+	for _, c := range chain {
+		if s, ok := g.states[c]; ok {
+			prior[c] = s
+		}
+	}
+	for _, c := range chain {
+		switch g.states[c] {
+		case Completed:
+			if c == id {
+				// the origin is aborted whatever its state
+				rollback = append(rollback, g.nodes[c])
+				break
+			}
+			report.Completed = append(report.Completed, c)
+			continue
+		case Aborted, PartialAbort:
+		default:
+			rollback = append(rollback, g.nodes[c])
+			// a blocked node signals the abort itself once it receives it (see Block)
+			if s, ok := prior[c]; (c == id || !ok || s != Waiting) && g.sending[c] == 0 {
+				if list, ok := abortSends(g.nodes[c], value, sortedSet(g.adj.in[c]), prior); ok {
+					sends = append(sends, list...)
+					g.markSignaled(c)
+				}
+			}
+		}
+		report.Aborted = append(report.Aborted, c)
+		if img, ok := g.images[c]; ok {
+			pre[c] = img
+		}
+		g.setState(c, value)
+	}
+	g.mu.Unlock()
+
+	signalChain(sends)
+	rollbackChain(rollback, pre, report)
+
+	return report, nil
+}
+
+// SetState records the state of the virtual node with the given id
+func (g *VDG) SetState(id int, s Signal) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if _, ok := g.nodes[id]; !ok {
+		return fmt.Errorf("Node %d does not exist in Dependency Graph.", id)
+	}
+	g.setState(id, s)
+
+	return nil
+}
+
+// setState must be called with the write lock held
+func (g *VDG) setState(id int, s Signal) {
+	if g.states == nil {
+		g.states = make(map[int]Signal)
+	}
+	g.states[id] = s
+	if s == Waiting {
+		// a new run: the node signals for itself again
+		delete(g.signaled, id)
+	}
+	if s == Started {
+		// the node is about to operate on its section (see restoreLists)
+		if g.images == nil {
+			g.images = make(map[int]image)
+		}
+		g.images[id] = imageOf(g.nodes[id])
+	}
+}
+
+// recordState records the state of a virtual node if it is (still) in the VDG
+func (g *VDG) recordState(id int, s Signal) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if _, ok := g.nodes[id]; ok {
+		g.setState(id, s)
+	}
+}
+
+// finish sends the final signal of a virtual node to its dependents, and only then
+// records it as the virtual node's state; the node counts as sending until then, and
+// sends nothing if an abort chain already signaled for it (see AbortChain)
+func (g *VDG) finish(n DGNode, s Signal) {
+	g.mu.Lock()
+	if g.signaled[n.ID()] {
+		delete(g.signaled, n.ID())
+		g.mu.Unlock()
+		return
+	}
+	if g.sending == nil {
+		g.sending = make(map[int]int)
+	}
+	g.sending[n.ID()]++
+	g.mu.Unlock()
+
+	n.Signal(nodeSignal(n, s))
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.sending[n.ID()]--; g.sending[n.ID()] == 0 {
+		delete(g.sending, n.ID())
+	}
+	if _, ok := g.nodes[n.ID()]; ok {
+		g.setState(n.ID(), s)
+	}
+}
+
+// markSignaled records that an abort chain sent the final signal of a virtual node;
+// must be called with the lock held
+func (g *VDG) markSignaled(id int) {
+	if g.signaled == nil {
+		g.signaled = make(map[int]bool)
+	}
+	g.signaled[id] = true
+}
+
+// forget drops everything recorded about a removed virtual node; must be called
+// with the lock held
+func (g *VDG) forget(id int) {
+	delete(g.states, id)
+	delete(g.images, id)
+	delete(g.signaled, id)
+}
+
+// State returns the last recorded state of the virtual node with the given id
+// (Waiting if none was recorded); false if the node is not in the VDG
+func (g *VDG) State(id int) (Signal, bool) {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	if _, ok := g.nodes[id]; !ok {
+		return Waiting, false
+	}
+
+	return g.states[id], true
+}
+
+// AbortChain propagates an Aborted or PartialAbort value from the virtual node
+// with the given id through all of its transitive dependents, rolling back
+// every node it aborts (the rollbacks run after the signals were delivered)
+func (g *VDG) AbortChain(id int, value Signal) (*AbortReport, error) {
+	if value != Aborted && value != PartialAbort {
+		return nil, fmt.Errorf("Abort chains can only propagate Aborted or PartialAbort signals.")
+	}
+
+	g.mu.Lock()
+	if _, ok := g.nodes[id]; !ok {
+		g.mu.Unlock()
+		return nil, fmt.Errorf("Node %d does not exist in Dependency Graph.", id)
+	}
+	report := &AbortReport{Origin: id, Value: value, Errors: make(map[int]error)}
+	var rollback []DGNode
+	var sends []send
+	pre := make(map[int]image)
+	chain := g.adj.chain(id)
+	prior := make(map[int]Signal, len(chain))
+	for _, c := range chain {
+		if s, ok := g.states[c]; ok {
+			prior[c] = s
+		}
+	}
+	for _, c := range chain {
+		switch g.states[c] {
+		case Completed:
+			if c == id {
+				// the origin is aborted whatever its state
+				rollback = append(rollback, g.nodes[c])
+				break
+			}
+			report.Completed = append(report.Completed, c)
+			continue
+		case Aborted, PartialAbort:
+		default:
+			rollback = append(rollback, g.nodes[c])
+			// a blocked node signals the abort itself once it receives it (see Block)
+			if s, ok := prior[c]; (c == id || !ok || s != Waiting) && g.sending[c] == 0 {
+				if list, ok := abortSends(g.nodes[c], value, sortedSet(g.adj.in[c]), prior); ok {
+					sends = append(sends, list...)
+					g.markSignaled(c)
+				}
+			}
+		}
+		report.Aborted = append(report.Aborted, c)
+		if img, ok := g.images[c]; ok {
+			pre[c] = img
+		}
+		g.setState(c, value)
+	}
+	g.mu.Unlock()
+
+	signalChain(sends)
+	rollbackChain(rollback, pre, report)
+
+	return report, nil
+}
+
+// chain returns the id of a node followed by the ids of all of its
+// transitive dependents, each dependent after all of its dependencies
+// that are in the chain
+func (a adjacency) chain(id int) []int {
+	reached := map[int]bool{id: true}
+	stack := []int{id}
+	for len(stack) > 0 {
+		n := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		for d := range a.in[n] {
+			if !reached[d] {
+				reached[d] = true
+				stack = append(stack, d)
+			}
+		}
+	}
+
+	// order the chain with the levels of the sub-index it spans
+	sub := newAdjacency()
+	for n := range reached {
+		sub.addNode(n)
+	}
+	for n := range reached {
+		for d := range a.in[n] {
+			sub.addEdge(d, n)
+		}
+	}
+	levels, ok := sub.levels()
+	if !ok {
+		// a cycle: fall back to id order
+		return sortedSet(toSet(reached))
+	}
+
+	var list []int
+	for _, l := range levels {
+		list = append(list, l...)
+	}
+
+	return list
+}
+
+func toSet(m map[int]bool) map[int]struct{} {
+	set := make(map[int]struct{}, len(m))
+	for id := range m {
+		set[id] = struct{}{}
+	}
+	return set
+}
+
+// send is a signal to deliver on the channel of an edge
+type send struct {
+	c chan NodeSignal
+	s NodeSignal
+}
+
+// abortSends returns the signals an abort chain sends on behalf of an aborted
+// node: one on the channel of every dependent that is blocked on the node
+// (recorded as Waiting). It returns false if the state of a dependent was
+// never recorded, as it may only start receiving later (the node's own final
+// signal reaches it then). Must be called with the lock held.
+func abortSends(n DGNode, value Signal, dependents []int, prior map[int]Signal) ([]send, bool) {
+	var sends []send
+	signalers := n.ListSignalers()
+	for _, d := range dependents {
+		s, ok := prior[d]
+		if !ok {
+			return nil, false
+		}
+		if c, ok := signalers[d]; ok && s == Waiting {
+			sends = append(sends, send{c: c, s: nodeSignal(n, value)})
+		}
+	}
+
+	return sends, true
+}
+
+// signalChain delivers the signals of an abort chain in the order of the
+// chain (dependencies before their dependents), without the lock held
+func signalChain(sends []send) {
+	for _, s := range sends {
+		s.c <- s.s
+	}
+}
+
+// rollbackChain rolls back the nodes of an abort chain, dependents first,
+// and sorts the report
+func rollbackChain(nodes []DGNode, pre map[int]image, report *AbortReport) {
+	for i := len(nodes) - 1; i >= 0; i-- {
+		n := nodes[i]
+
+		restoreNodes, restoreEdges := restoreLists(n, pre)
+		for _, p := range n.ListProcedures() {
+			if err := p.Rollback(restoreNodes, restoreEdges); err != nil {
+				report.Errors[n.ID()] = err
+			}
+		}
+	}
+
+	sort.Ints(report.Aborted)
+	sort.Ints(report.Completed)
+}
+
+// image is a copy of the CDS nodes and edges of the section a node operates
+// on, taken when the node is recorded as Started (i.e. before its access
+// procedures run)
+type image struct {
+	nodes RestoreNodes
+	edges RestoreEdges
+}
+
+// imageOf copies the CDS nodes and edges of the section a node operates on
+func imageOf(n DGNode) image {
+	var img image
+
+	space := spaceOf(n)
+	if space == nil || space.GetSection() == nil {
+		return img
+	}
+	if nodes := space.GetSection().ListNodes(); nodes != nil {
+		img.nodes = append(RestoreNodes(nil), *nodes...)
+	}
+	if edges := space.GetSection().ListEdges(); edges != nil {
+		img.edges = append(RestoreEdges(nil), *edges...)
+	}
+
+	return img
+}
+
+// restoreLists returns the CDS nodes and edges of the section a node operates
+// on as they were before the node started, or as they are now if it never
+// started (and so never operated on the section)
+func restoreLists(n DGNode, pre map[int]image) (RestoreNodes, RestoreEdges) {
+	img, ok := pre[n.ID()]
+	if !ok {
+		img = imageOf(n)
+	}
+
+	return img.nodes, img.edges
+}
@@ -6,13 +6,12 @@ package fabric
 // IMPORTANT: In order to best utilize the commit and rollback features
 // the Access Type should have an error return value.
 type AccessType interface {
-	// Class() string                             // the "class" of action (e.g. "read")
+	// NOTE: an access type can declare the "class" of its action (e.g. "read") by implementing Classed,
+	// and the CDS nodes and edges it leaves invariant by implementing Invariant
 	ID() int                                   // integer id assigned to Access Type
 	Priority() int                             // priorities are not a necessity but can be helpful for ordering algorithms for posets
 	Commit(DGNode) error                       // takes a DGNode to signal for ...
 	Rollback(RestoreNodes, RestoreEdges) error // takes a list of all CDS nodes and edges that have been operated on
-	// InvariantNode(*Node) bool                  // used to calculate if a CDS node should remain invariant
-	// InvariantEdge(*Edge) bool                  // used to calculate if a CDS edge should remain invariant
 }
 
 // RestoreNodes is a list of Node values that can be used to overwrite existing
@@ -23,12 +22,5 @@ type RestoreNodes []Node
 // Edge values after an operation failure.
 type RestoreEdges []Edge
 
-// IDEA:
-// 	create a function that accepts a Section as an argument
-// 	and uses InvariantNode() and InvariantEdge() on all objects in the section
-// 	then returns a list of invariant nodes and edges for an Access Procedure
-// 	on a section.
-// 	`InvariantSets(s Section) (NodeList, EdgeList)`
-
 // ProcedureList ...
 type ProcedureList []AccessType
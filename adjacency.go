@@ -0,0 +1,118 @@
+package fabric
+
+import "sort"
+
+/*
+	Adjacency Indexes
+
+	Both Graph and VDG keep their topology in an exported `Top` map of
+	node -> dependencies. Looking up a node by ID, or finding the dependents
+	of a node, in that layout requires scanning every entry of the map.
+
+	An adjacency index keeps forward (dependencies) and reverse (dependents)
+	sets keyed by node ID, so that edge insertion, dependents/dependencies
+	lookup and node removal are O(degree). The index only stores IDs; each
+	graph type keeps its own ID -> node map.
+*/
+
+// adjacency is an ID-indexed forward and reverse adjacency index
+// NOTE: an edge `from -> to` means `from` depends on `to`
+// (i.e. `to` signals `from`), the same direction as Graph.Top
+type adjacency struct {
+	out map[int]map[int]struct{} // node id -> ids of its dependencies
+	in  map[int]map[int]struct{} // node id -> ids of its dependents
+}
+
+func newAdjacency() adjacency {
+	return adjacency{
+		out: make(map[int]map[int]struct{}),
+		in:  make(map[int]map[int]struct{}),
+	}
+}
+
+// addNode registers a node without any edges
+func (a adjacency) addNode(id int) {
+	if _, ok := a.out[id]; !ok {
+		a.out[id] = make(map[int]struct{})
+	}
+	if _, ok := a.in[id]; !ok {
+		a.in[id] = make(map[int]struct{})
+	}
+}
+
+// hasEdge reports whether `from` depends on `to`
+func (a adjacency) hasEdge(from, to int) bool {
+	_, ok := a.out[from][to]
+	return ok
+}
+
+// addEdge records that `from` depends on `to`; both nodes must already exist
+func (a adjacency) addEdge(from, to int) {
+	a.out[from][to] = struct{}{}
+	a.in[to][from] = struct{}{}
+}
+
+// removeEdge deletes the edge `from -> to` if it exists
+func (a adjacency) removeEdge(from, to int) {
+	delete(a.out[from], to)
+	delete(a.in[to], from)
+}
+
+// removeNode deletes a node and every edge that touches it
+func (a adjacency) removeNode(id int) {
+	for to := range a.out[id] {
+		delete(a.in[to], id)
+	}
+	for from := range a.in[id] {
+		delete(a.out[from], id)
+	}
+	delete(a.out, id)
+	delete(a.in, id)
+}
+
+// ids returns all node ids in the index in sorted order
+func (a adjacency) ids() []int {
+	list := make([]int, 0, len(a.out))
+	for id := range a.out {
+		list = append(list, id)
+	}
+	sort.Ints(list)
+	return list
+}
+
+// levels groups the node ids into antichains using Kahn's algorithm:
+// level 0 holds the nodes without dependencies, and every other node is in
+// the level after its last dependency. Each level is sorted by id, so the
+// result is deterministic for equal inputs. Returns false if the index
+// contains a cycle.
+func (a adjacency) levels() ([][]int, bool) {
+	pending := make(map[int]int, len(a.out))
+	var current []int
+	for id, deps := range a.out {
+		pending[id] = len(deps)
+		if len(deps) == 0 {
+			current = append(current, id)
+		}
+	}
+
+	var levels [][]int
+	seen := 0
+	for len(current) > 0 {
+		sort.Ints(current)
+		levels = append(levels, current)
+		seen += len(current)
+
+		var next []int
+		for _, id := range current {
+			for d := range a.in[id] {
+				pending[d]--
+				if pending[d] == 0 {
+					next = append(next, d)
+				}
+			}
+		}
+		current = next
+	}
+
+	return levels, seen == len(a.out)
+}
@@ -0,0 +1,302 @@
+package fabric
+
+import (
+	"sort"
+	"sync"
+)
+
+/*
+	Signal Backends
+
+	A SignalBackend creates the channels behind the SignalingMap and
+	SignalsMap of every edge in a dependency graph. DGNode implementations
+	keep sending on their SignalingMap channels and receiving from their
+	SignalsMap channels, whichever backend created them.
+
+	ChannelBackend (the default; every graph and VDG has its own) creates
+	one unbuffered channel per edge: a node's Signal blocks until every
+	dependent is receiving, and a dependent that starts receiving late (or
+	is connected after the signal was sent) misses it.
+
+	SignalBus retains the latest signal of every node per access type, and
+	never blocks the sender: signals are queued for slow dependents, and a
+	dependent connected after a signal was sent observes the retained
+	signals first (last-value replay).
+*/
+
+// SignalBackend creates and retires the signaling channels of dependency graph edges
+type SignalBackend interface {
+	// Connect returns the channel the dependency sends its signals on (the
+	// dependency's SignalingMap entry for the dependent), and the channel the
+	// dependent receives them from (the dependent's SignalsMap entry for the dependency)
+	Connect(dependency, dependent int) (chan NodeSignal, <-chan NodeSignal)
+	// Disconnect retires the channels of an edge
+	Disconnect(dependency, dependent int)
+}
+
+// ChannelBackend creates a single unbuffered channel per edge
+type ChannelBackend struct {
+	mu       sync.Mutex
+	channels map[[2]int]chan NodeSignal
+}
+
+// NewChannelBackend ...
+func NewChannelBackend() *ChannelBackend {
+	return &ChannelBackend{
+		channels: make(map[[2]int]chan NodeSignal),
+	}
+}
+
+// Connect ...
+func (b *ChannelBackend) Connect(dependency, dependent int) (chan NodeSignal, <-chan NodeSignal) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	c := make(chan NodeSignal)
+	b.channels[[2]int{dependency, dependent}] = c
+
+	return c, c
+}
+
+// Disconnect closes the channel of the edge
+// NOTE: the dependency must not be sending on the channel anymore
+func (b *ChannelBackend) Disconnect(dependency, dependent int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	key := [2]int{dependency, dependent}
+	if c, ok := b.channels[key]; ok {
+		close(c)
+		delete(b.channels, key)
+	}
+}
+
+// SignalBus is a non-blocking SignalBackend with last-value replay
+type SignalBus struct {
+	// Buffer is the capacity of the channels dependencies send on; it only
+	// absorbs bursts, as every signal is immediately moved to an unbounded queue
+	Buffer int
+
+	mu    sync.Mutex
+	last  map[int]map[int]NodeSignal // node id -> access type id -> latest signal
+	seq   map[int]int                // node id -> number of signals recorded for the node
+	pipes map[int]map[int]*pipe      // dependency id -> dependent id -> pipe
+}
+
+// NewSignalBus ...
+func NewSignalBus() *SignalBus {
+	return &SignalBus{
+		Buffer: 16,
+		last:   make(map[int]map[int]NodeSignal),
+		seq:    make(map[int]int),
+		pipes:  make(map[int]map[int]*pipe),
+	}
+}
+
+// pipe moves the signals of one edge from the dependency to the dependent
+// through an unbounded queue; only the pipe's pump receives from `in`, so
+// the signals of an edge are always recorded in the order they were sent
+type pipe struct {
+	dependency int
+	offset     int // signals the dependency had sent before the pipe was connected
+	received   int
+
+	in    chan NodeSignal
+	out   chan NodeSignal
+	quit  chan struct{}
+	flush chan chan struct{}
+	done  chan struct{}
+}
+
+// Connect creates the channels of an edge; the dependent first receives the
+// latest signal the dependency sent for every access type (if any)
+func (b *SignalBus) Connect(dependency, dependent int) (chan NodeSignal, <-chan NodeSignal) {
+	// signals the dependency already sent on its other edges
+	// may not have been picked up yet
+	b.sync(dependency)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	p := &pipe{
+		dependency: dependency,
+		offset:     b.seq[dependency],
+		in:         make(chan NodeSignal, b.Buffer),
+		out:        make(chan NodeSignal),
+		quit:       make(chan struct{}),
+		flush:      make(chan chan struct{}),
+		done:       make(chan struct{}),
+	}
+	if _, ok := b.pipes[dependency]; !ok {
+		b.pipes[dependency] = make(map[int]*pipe)
+	}
+	b.pipes[dependency][dependent] = p
+
+	go b.pump(p, b.replay(dependency))
+
+	return p.in, p.out
+}
+
+// Disconnect stops accepting signals on the edge; signals that were already
+// sent are still delivered before the dependent's channel is closed
+func (b *SignalBus) Disconnect(dependency, dependent int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if p, ok := b.pipes[dependency][dependent]; ok {
+		close(p.quit)
+		delete(b.pipes[dependency], dependent)
+	}
+}
+
+// Last returns the latest signal a node sent for every access type (sorted by access type)
+func (b *SignalBus) Last(node int) []NodeSignal {
+	b.sync(node)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.replay(node)
+}
+
+// sync waits until every signal a node has sent is recorded
+func (b *SignalBus) sync(node int) {
+	b.mu.Lock()
+	var pipes []*pipe
+	for _, p := range b.pipes[node] {
+		pipes = append(pipes, p)
+	}
+	b.mu.Unlock()
+
+	for _, p := range pipes {
+		ack := make(chan struct{})
+		select {
+		case p.flush <- ack:
+			<-ack
+		case <-p.done:
+		}
+	}
+}
+
+// replay must be called with the lock held
+func (b *SignalBus) replay(node int) []NodeSignal {
+	var list []NodeSignal
+	for _, s := range b.last[node] {
+		list = append(list, s)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].AccessType < list[j].AccessType })
+
+	return list
+}
+
+// record keeps a signal as the latest of its access type, unless another
+// edge of the dependency has already recorded a later one
+func (b *SignalBus) record(p *pipe, s NodeSignal) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	p.received++
+	if p.offset+p.received <= b.seq[p.dependency] {
+		return
+	}
+	b.seq[p.dependency] = p.offset + p.received
+
+	if _, ok := b.last[p.dependency]; !ok {
+		b.last[p.dependency] = make(map[int]NodeSignal)
+	}
+	b.last[p.dependency][s.AccessType] = s
+}
+
+func (b *SignalBus) pump(p *pipe, queue []NodeSignal) {
+	defer close(p.out)
+	defer close(p.done)
+
+	in, quit := p.in, p.quit
+	// collect moves the signals buffered in `in` to the queue
+	collect := func() {
+		for {
+			select {
+			case s := <-in:
+				b.record(p, s)
+				queue = append(queue, s)
+			default:
+				return
+			}
+		}
+	}
+
+	for {
+		var out chan NodeSignal
+		var next NodeSignal
+		if len(queue) > 0 {
+			out = p.out
+			next = queue[0]
+		} else if in == nil {
+			return
+		}
+
+		select {
+		case s := <-in:
+			b.record(p, s)
+			queue = append(queue, s)
+		case out <- next:
+			queue = queue[1:]
+		case ack := <-p.flush:
+			collect()
+			close(ack)
+		case <-quit:
+			// deliver what was already sent, but accept nothing new
+			collect()
+			in, quit = nil, nil
+		}
+	}
+}
+
+// SetSignalBackend sets the backend used to create the signaling channels of
+// new edges (the default is an unbuffered channel per edge)
+func (g *Graph) SetSignalBackend(b SignalBackend) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.signals = b
+}
+
+// backend must be called with the (write) lock held
+func (g *Graph) backend() SignalBackend {
+	if g.signals != nil {
+		return g.signals
+	}
+	// node ids are only unique within a graph, so every graph has its own channels
+	if g.channels == nil {
+		g.channels = NewChannelBackend()
+	}
+	return g.channels
+}
+
+// SetSignalBackend sets the backend used to create the signaling channels of
+// new edges (by default a VDG uses the backend set on its global graph, if any)
+func (g *VDG) SetSignalBackend(b SignalBackend) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.signals = b
+}
+
+// backend must be called with the (write) lock held
+func (g *VDG) backend() SignalBackend {
+	if g.signals != nil {
+		return g.signals
+	}
+	if g.Global != nil {
+		g.Global.mu.RLock()
+		b := g.Global.signals
+		g.Global.mu.RUnlock()
+		if b != nil {
+			return b
+		}
+	}
+	if g.channels == nil {
+		g.channels = NewChannelBackend()
+	}
+	return g.channels
+}
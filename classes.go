@@ -0,0 +1,182 @@
+package fabric
+
+/*
+	Access Classes
+
+	Not every pair of access procedures on the same space conflicts: any
+	number of reads can run at the same time, while a write conflicts with
+	everything else. An access type declares its class (the kind of action
+	it takes) by implementing Classed:
+
+		ReadClass   - only reads CDS nodes/edges
+		WriteClass  - updates CDS nodes/edges in place
+		InsertClass - adds CDS nodes/edges (a structural change)
+		DeleteClass - removes CDS nodes/edges (a structural change)
+
+	or any custom class name. Access types that do not implement Classed are
+	treated as writes, the conservative choice.
+
+	A CompatibilityMatrix decides which classes commute (may run at the same
+	time on the same space). Every Graph and VDG has one (DefaultCompatibility
+	unless set with SetCompatibility), and Conflicts uses it (together with
+	the write sets of the nodes' procedures, see Invariant) to decide whether
+	two nodes must be ordered: Posets and schedulers only need to add a
+	dependency between nodes that conflict.
+*/
+
+// AccessClass is the kind of action an access type takes
+type AccessClass string
+
+const (
+	// ReadClass only reads CDS nodes/edges
+	ReadClass AccessClass = "read"
+	// WriteClass updates CDS nodes/edges in place
+	WriteClass AccessClass = "write"
+	// InsertClass adds CDS nodes/edges
+	InsertClass AccessClass = "insert"
+	// DeleteClass removes CDS nodes/edges
+	DeleteClass AccessClass = "delete"
+)
+
+// Classed is implemented by access types that declare their class
+type Classed interface {
+	Class() AccessClass
+}
+
+// ClassOf returns the class of an access type (WriteClass if it does not declare one)
+func ClassOf(at AccessType) AccessClass {
+	if c, ok := at.(Classed); ok {
+		return c.Class()
+	}
+	return WriteClass
+}
+
+// CompatibilityMatrix records which pairs of access classes commute
+// (missing pairs do not)
+type CompatibilityMatrix map[AccessClass]map[AccessClass]bool
+
+// DefaultCompatibility returns a matrix where only reads commute (with each other)
+func DefaultCompatibility() CompatibilityMatrix {
+	m := make(CompatibilityMatrix)
+	m.Allow(ReadClass, ReadClass)
+
+	return m
+}
+
+// Allow records that two classes commute (in both directions)
+func (m CompatibilityMatrix) Allow(a, b AccessClass) {
+	if m[a] == nil {
+		m[a] = make(map[AccessClass]bool)
+	}
+	if m[b] == nil {
+		m[b] = make(map[AccessClass]bool)
+	}
+	m[a][b] = true
+	m[b][a] = true
+}
+
+// Forbid records that two classes conflict (in both directions)
+func (m CompatibilityMatrix) Forbid(a, b AccessClass) {
+	delete(m[a], b)
+	delete(m[b], a)
+}
+
+// Compatible reports whether two classes commute
+func (m CompatibilityMatrix) Compatible(a, b AccessClass) bool {
+	return m[a][b]
+}
+
+// conflicts reports whether two nodes must be ordered: some access procedure
+// of one does not commute with some access procedure of the other, and one
+// of the two may write what the other accesses (see WriteSets).
+// A node without access procedures conflicts with every node.
+func (m CompatibilityMatrix) conflicts(a, b DGNode) bool {
+	pa, pb := a.ListProcedures(), b.ListProcedures()
+	if len(pa) == 0 || len(pb) == 0 {
+		return true
+	}
+
+	// the sections of the nodes (unknown sections always interfere)
+	sa, sb := sectionOf(a), sectionOf(b)
+	known := sa != nil && sb != nil
+	if known && CDSOf(spaceOf(a)) != CDSOf(spaceOf(b)) {
+		return false
+	}
+	var na, ea, nb, eb map[int]struct{}
+	if known {
+		na, ea = sectionIDs(sa)
+		nb, eb = sectionIDs(sb)
+	}
+
+	for _, x := range pa {
+		for _, y := range pb {
+			if m.Compatible(ClassOf(x), ClassOf(y)) {
+				continue
+			}
+			if !known || writes(x, sa, nb, eb) || writes(y, sb, na, ea) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// SetCompatibility sets the compatibility matrix of the graph (nil restores
+// DefaultCompatibility)
+func (g *Graph) SetCompatibility(m CompatibilityMatrix) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.compat = m
+}
+
+// Compatibility returns the compatibility matrix of the graph
+func (g *Graph) Compatibility() CompatibilityMatrix {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	return g.compatibility()
+}
+
+func (g *Graph) compatibility() CompatibilityMatrix {
+	if g.compat == nil {
+		return DefaultCompatibility()
+	}
+	return g.compat
+}
+
+// Conflicts reports whether two nodes of the graph must be ordered, according
+// to the classes and write sets of their access procedures
+func (g *Graph) Conflicts(a, b DGNode) bool {
+	return g.Compatibility().conflicts(a, b)
+}
+
+// SetCompatibility sets the compatibility matrix of the VDG (nil uses the
+// matrix of the global graph)
+func (g *VDG) SetCompatibility(m CompatibilityMatrix) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.compat = m
+}
+
+// Compatibility returns the compatibility matrix of the VDG
+func (g *VDG) Compatibility() CompatibilityMatrix {
+	g.mu.RLock()
+	m := g.compat
+	g.mu.RUnlock()
+
+	if m != nil {
+		return m
+	}
+	if g.Global != nil {
+		return g.Global.Compatibility()
+	}
+	return DefaultCompatibility()
+}
+
+// Conflicts reports whether two nodes of the VDG must be ordered, according
+// to the classes and write sets of their access procedures
+func (g *VDG) Conflicts(a, b DGNode) bool {
+	return g.Compatibility().conflicts(a, b)
+}
@@ -0,0 +1,137 @@
+package fabric
+
+import (
+	"fmt"
+	"sort"
+)
+
+/*
+	Coverage Reports
+
+	A CDS is covered when every one of its nodes and edges is part of the
+	Section of at least one UI of the CDS. A CoverageReport lists what is
+	missing (uncovered nodes and edges) and what is covered by more than one
+	UI (over-covered nodes and edges, which must be ordered against each
+	other, see OrderOverlaps).
+
+	CoverRemainder adds a UI over every uncovered node and edge of a CDS,
+	so that a graph can be made total in one call.
+*/
+
+// CoverageReport describes how the UIs of a graph cover a CDS
+type CoverageReport struct {
+	CDS              string
+	UncoveredNodes   []int         // ids of the CDS nodes no UI covers (sorted)
+	UncoveredEdges   []int         // ids of the CDS edges no UI covers (sorted)
+	OverCoveredNodes map[int][]int // CDS node id -> ids of the UIs that cover it (sorted)
+	OverCoveredEdges map[int][]int // CDS edge id -> ids of the UIs that cover it (sorted)
+}
+
+// Covered returns true if every node and edge of the CDS is covered
+func (r *CoverageReport) Covered() bool {
+	return len(r.UncoveredNodes) == 0 && len(r.UncoveredEdges) == 0
+}
+
+// Coverage reports how the UIs of the named CDS cover it
+func (g *Graph) Coverage(name string) (*CoverageReport, error) {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	return g.coverage(name)
+}
+
+func (g *Graph) coverage(name string) (*CoverageReport, error) {
+	ds, ok := g.cds(name)
+	if !ok || ds == nil {
+		return nil, fmt.Errorf("CDS %q is not registered.", name)
+	}
+
+	// CDS node/edge id -> ids of the UIs that cover it
+	nodeUIs := make(map[int][]int)
+	edgeUIs := make(map[int][]int)
+	for _, u := range g.uis(name) {
+		nodes, edges := sectionIDs(u.GetSection())
+		for id := range nodes {
+			nodeUIs[id] = append(nodeUIs[id], u.ID())
+		}
+		for id := range edges {
+			edgeUIs[id] = append(edgeUIs[id], u.ID())
+		}
+	}
+
+	r := &CoverageReport{
+		CDS:              name,
+		OverCoveredNodes: make(map[int][]int),
+		OverCoveredEdges: make(map[int][]int),
+	}
+	for _, n := range ds.ListNodes() {
+		switch uis := nodeUIs[n.ID()]; {
+		case len(uis) == 0:
+			r.UncoveredNodes = append(r.UncoveredNodes, n.ID())
+		case len(uis) > 1:
+			sort.Ints(uis)
+			r.OverCoveredNodes[n.ID()] = uis
+		}
+	}
+	for _, e := range ds.ListEdges() {
+		switch uis := edgeUIs[e.ID()]; {
+		case len(uis) == 0:
+			r.UncoveredEdges = append(r.UncoveredEdges, e.ID())
+		case len(uis) > 1:
+			sort.Ints(uis)
+			r.OverCoveredEdges[e.ID()] = uis
+		}
+	}
+	sort.Ints(r.UncoveredNodes)
+	sort.Ints(r.UncoveredEdges)
+
+	return r, nil
+}
+
+// CoverRemainder adds a UI over every node and edge of the named CDS that is
+// not covered yet, and returns it (nil if the CDS is already covered)
+func (g *Graph) CoverRemainder(name string) (UI, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	r, err := g.coverage(name)
+	if err != nil {
+		return nil, err
+	}
+	if r.Covered() {
+		return nil, nil
+	}
+
+	ds, _ := g.cds(name)
+	uncoveredNodes := make(map[int]struct{}, len(r.UncoveredNodes))
+	for _, id := range r.UncoveredNodes {
+		uncoveredNodes[id] = struct{}{}
+	}
+	uncoveredEdges := make(map[int]struct{}, len(r.UncoveredEdges))
+	for _, id := range r.UncoveredEdges {
+		uncoveredEdges[id] = struct{}{}
+	}
+	nodes := make(NodeList, 0, len(uncoveredNodes))
+	for _, n := range ds.ListNodes() {
+		if _, ok := uncoveredNodes[n.ID()]; ok {
+			nodes = append(nodes, n)
+		}
+	}
+	edges := make(EdgeList, 0, len(uncoveredEdges))
+	for _, e := range ds.ListEdges() {
+		if _, ok := uncoveredEdges[e.ID()]; ok {
+			edges = append(edges, e)
+		}
+	}
+
+	id, err := g.nextNodeID()
+	if err != nil {
+		return nil, err
+	}
+	ui := NewCDSUI(id, name, NewDisjoint(&nodes, &edges))
+	if _, err := g.addNode(ui); err != nil {
+		return nil, err
+	}
+
+	return ui, nil
+}
@@ -0,0 +1,196 @@
+package fabric
+
+import (
+	"sort"
+	"time"
+)
+
+/*
+	Critical Path Analysis
+
+	Given a cost (duration) for every node, the critical path of a
+	dependency graph is the chain of dependencies with the largest total
+	cost: no schedule can finish before it does, however many nodes run in
+	parallel. CriticalPath computes, for every node:
+
+		EarliestStart - when the node can start at the earliest (all of its
+		                dependencies have finished)
+		LatestStart   - when the node must start at the latest for the graph
+		                to still finish in the makespan
+		Slack         - LatestStart - EarliestStart; nodes on the critical
+		                path have no slack
+
+	plus the makespan (the length of the critical path), the total work
+	(the sum of all costs) and the theoretical parallelism of the graph
+	(work / makespan: the average number of nodes that run at the same time
+	in an ideal schedule).
+
+	Costs can be estimates, or the durations measured by an Executor (see
+	ExecutionResult.Cost).
+*/
+
+// CostFunc returns the cost (duration) of a node
+type CostFunc func(DGNode) time.Duration
+
+// NodeSchedule is the timing of a node in an ideal schedule of a dependency graph
+type NodeSchedule struct {
+	ID            int
+	Cost          time.Duration
+	EarliestStart time.Duration
+	LatestStart   time.Duration
+	Slack         time.Duration
+}
+
+// CriticalPath is the result of the critical path analysis of a dependency graph
+type CriticalPath struct {
+	Path        []int          // ids of the nodes on the critical path, dependencies first
+	Makespan    time.Duration  // the total cost of the critical path
+	Work        time.Duration  // the total cost of all nodes
+	Parallelism float64        // Work / Makespan (0 for an empty graph)
+	Nodes       []NodeSchedule // the schedule of every node (sorted by id)
+}
+
+// Schedule returns the schedule of the node with the given id
+func (c *CriticalPath) Schedule(id int) (NodeSchedule, bool) {
+	i := sort.Search(len(c.Nodes), func(i int) bool { return c.Nodes[i].ID >= id })
+	if i < len(c.Nodes) && c.Nodes[i].ID == id {
+		return c.Nodes[i], true
+	}
+	return NodeSchedule{}, false
+}
+
+// clone returns a copy of the index
+func (a adjacency) clone() adjacency {
+	c := newAdjacency()
+	for id := range a.out {
+		c.addNode(id)
+	}
+	for id, deps := range a.out {
+		for d := range deps {
+			c.addEdge(id, d)
+		}
+	}
+	return c
+}
+
+// criticalPath analyzes an acyclic index; returns false if the index has a cycle
+func (a adjacency) criticalPath(cost map[int]time.Duration) (*CriticalPath, bool) {
+	levels, ok := a.levels()
+	if !ok {
+		return nil, false
+	}
+
+	cp := &CriticalPath{}
+	earliest := make(map[int]time.Duration, len(a.out))
+	latest := make(map[int]time.Duration, len(a.out))
+
+	// forward pass: dependencies first
+	for _, l := range levels {
+		for _, id := range l {
+			for d := range a.out[id] {
+				if finish := earliest[d] + cost[d]; finish > earliest[id] {
+					earliest[id] = finish
+				}
+			}
+			if finish := earliest[id] + cost[id]; finish > cp.Makespan {
+				cp.Makespan = finish
+			}
+			cp.Work += cost[id]
+		}
+	}
+
+	// backward pass: dependents first
+	for i := len(levels) - 1; i >= 0; i-- {
+		for _, id := range levels[i] {
+			finish := cp.Makespan
+			for d := range a.in[id] {
+				if latest[d] < finish {
+					finish = latest[d]
+				}
+			}
+			latest[id] = finish - cost[id]
+		}
+	}
+
+	for _, id := range a.ids() {
+		cp.Nodes = append(cp.Nodes, NodeSchedule{
+			ID:            id,
+			Cost:          cost[id],
+			EarliestStart: earliest[id],
+			LatestStart:   latest[id],
+			Slack:         latest[id] - earliest[id],
+		})
+	}
+	if cp.Makespan > 0 {
+		cp.Parallelism = float64(cp.Work) / float64(cp.Makespan)
+	}
+
+	// walk the critical path back from the (lowest id) node that finishes last
+	current, found := 0, false
+	for _, id := range a.ids() {
+		if latest[id] == earliest[id] && earliest[id]+cost[id] == cp.Makespan {
+			current, found = id, true
+			break
+		}
+	}
+	for found {
+		cp.Path = append(cp.Path, current)
+		found = false
+		for _, d := range sortedSet(a.out[current]) {
+			if latest[d] == earliest[d] && earliest[d]+cost[d] == earliest[current] {
+				current, found = d, true
+				break
+			}
+		}
+	}
+	for i, j := 0, len(cp.Path)-1; i < j; i, j = i+1, j-1 {
+		cp.Path[i], cp.Path[j] = cp.Path[j], cp.Path[i]
+	}
+
+	return cp, true
+}
+
+// CriticalPath computes the critical path, makespan and parallelism of the
+// graph, and the earliest/latest start and slack of every node.
+// Fails with a *CycleError if the graph has a cycle.
+func (g *Graph) CriticalPath(cost CostFunc) (*CriticalPath, error) {
+	// the cost function is called without holding the lock
+	g.mu.RLock()
+	a := g.adj.clone()
+	nodes := make(map[int]DGNode, len(g.nodes))
+	for id, n := range g.nodes {
+		nodes[id] = n
+	}
+	g.mu.RUnlock()
+
+	return analyze(a, nodes, cost)
+}
+
+// CriticalPath computes the critical path, makespan and parallelism of the
+// VDG, and the earliest/latest start and slack of every node.
+// Fails with a *CycleError if the VDG has a cycle.
+func (g *VDG) CriticalPath(cost CostFunc) (*CriticalPath, error) {
+	g.mu.RLock()
+	a := g.adj.clone()
+	nodes := make(map[int]DGNode, len(g.nodes))
+	for id, n := range g.nodes {
+		nodes[id] = n
+	}
+	g.mu.RUnlock()
+
+	return analyze(a, nodes, cost)
+}
+
+func analyze(a adjacency, nodes map[int]DGNode, cost CostFunc) (*CriticalPath, error) {
+	costs := make(map[int]time.Duration, len(nodes))
+	for id, n := range nodes {
+		costs[id] = cost(n)
+	}
+
+	cp, ok := a.criticalPath(costs)
+	if !ok {
+		return nil, &CycleError{Path: a.findCycle()}
+	}
+
+	return cp, nil
+}
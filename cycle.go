@@ -0,0 +1,211 @@
+package fabric
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+/*
+	Cycles
+
+	A cycle in a dependency graph means that every node in the cycle waits
+	on a signal from another node in the cycle, so none of them can ever
+	start (i.e. the signal channels deadlock).
+
+	Cycles can be found after the fact (CycleDetect, Cycle), or a Graph or
+	VDG can be told to refuse any edge that would close a cycle with
+	RejectCycles(true). Rejection uses incremental reachability: the graph
+	keeps a topological order of its nodes (Pearce-Kelly), so an edge that
+	agrees with the order is accepted in O(1), and an edge that does not only
+	searches the nodes between its two endpoints in the order, instead of a
+	full depth-first-search of the graph for every inserted edge.
+*/
+
+// CycleError is returned when a dependency graph contains a cycle, or when
+// an edge would create one. Path lists the node ids of the cycle in order:
+// every node depends on the next one, and the last node depends on the first.
+type CycleError struct {
+	Path []int
+}
+
+// Error ...
+func (e *CycleError) Error() string {
+	ids := make([]string, 0, len(e.Path)+1)
+	for _, id := range e.Path {
+		ids = append(ids, strconv.Itoa(id))
+	}
+	if len(e.Path) > 0 {
+		ids = append(ids, strconv.Itoa(e.Path[0]))
+	}
+
+	return fmt.Sprintf("Dependency cycle: %s", strings.Join(ids, " -> "))
+}
+
+// findCycle returns the ids of a cycle in the index (in dependency order),
+// or nil if the index is acyclic
+func (a adjacency) findCycle() []int {
+	const (
+		white = iota
+		grey
+		black
+	)
+	color := make(map[int]int, len(a.out))
+	var stack []int
+
+	var visit func(id int) []int
+	visit = func(id int) []int {
+		color[id] = grey
+		stack = append(stack, id)
+		for _, next := range sortedSet(a.out[id]) {
+			switch color[next] {
+			case grey:
+				// the cycle is the part of the stack starting at next
+				for i, s := range stack {
+					if s == next {
+						return append([]int(nil), stack[i:]...)
+					}
+				}
+			case white:
+				if cycle := visit(next); cycle != nil {
+					return cycle
+				}
+			}
+		}
+		stack = stack[:len(stack)-1]
+		color[id] = black
+		return nil
+	}
+
+	for _, id := range a.ids() {
+		if color[id] == white {
+			if cycle := visit(id); cycle != nil {
+				return cycle
+			}
+		}
+	}
+	return nil
+}
+
+func sortedSet(set map[int]struct{}) []int {
+	list := make([]int, 0, len(set))
+	for id := range set {
+		list = append(list, id)
+	}
+	sort.Ints(list)
+	return list
+}
+
+// topoOrder is a dynamic topological order of an adjacency index
+// (Pearce-Kelly): a dependency always has a lower position than its dependents
+type topoOrder struct {
+	pos  map[int]int
+	next int
+}
+
+// newTopoOrder computes an initial order for the index, or returns the
+// cycle that prevents one
+func newTopoOrder(a adjacency) (*topoOrder, []int) {
+	levels, ok := a.levels()
+	if !ok {
+		return nil, a.findCycle()
+	}
+
+	o := &topoOrder{pos: make(map[int]int, len(a.out))}
+	for _, l := range levels {
+		for _, id := range l {
+			o.addNode(id)
+		}
+	}
+
+	return o, nil
+}
+
+func (o *topoOrder) addNode(id int) {
+	o.pos[id] = o.next
+	o.next++
+}
+
+func (o *topoOrder) removeNode(id int) {
+	delete(o.pos, id)
+}
+
+// insertEdge updates the order for a new edge `from -> to` (from depends on
+// to) that has not been added to the index yet. If the edge would create a
+// cycle the order is left untouched and the cycle is returned.
+func (o *topoOrder) insertEdge(a adjacency, from, to int) []int {
+	if from == to {
+		return []int{from}
+	}
+
+	lower, upper := o.pos[from], o.pos[to]
+	if upper < lower {
+		// the dependency already comes first
+		return nil
+	}
+
+	// forward search: dependents of `from` that are placed before `to`
+	parent := make(map[int]int)
+	var forward []int
+	visited := map[int]bool{from: true}
+	stack := []int{from}
+	for len(stack) > 0 {
+		id := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		forward = append(forward, id)
+
+		for d := range a.in[id] {
+			if d == to {
+				// `to` already (transitively) depends on `from`
+				cycle := []int{from, to}
+				for p := id; p != from; p = parent[p] {
+					cycle = append(cycle, p)
+				}
+				return cycle
+			}
+			if !visited[d] && o.pos[d] < upper {
+				visited[d] = true
+				parent[d] = id
+				stack = append(stack, d)
+			}
+		}
+	}
+
+	// backward search: dependencies of `to` that are placed after `from`
+	var backward []int
+	visited[to] = true
+	stack = []int{to}
+	for len(stack) > 0 {
+		id := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		backward = append(backward, id)
+
+		for d := range a.out[id] {
+			if !visited[d] && o.pos[d] > lower {
+				visited[d] = true
+				stack = append(stack, d)
+			}
+		}
+	}
+
+	// reorder: the backward set takes the lowest of the affected positions,
+	// keeping the relative order within each set
+	byPos := func(ids []int) {
+		sort.Slice(ids, func(i, j int) bool { return o.pos[ids[i]] < o.pos[ids[j]] })
+	}
+	byPos(backward)
+	byPos(forward)
+
+	affected := append(backward, forward...)
+	positions := make([]int, 0, len(affected))
+	for _, id := range affected {
+		positions = append(positions, o.pos[id])
+	}
+	sort.Ints(positions)
+	for i, id := range affected {
+		o.pos[id] = positions[i]
+	}
+
+	return nil
+}
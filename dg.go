@@ -2,10 +2,8 @@ package fabric
 
 import (
 	"fmt"
-	"math/rand"
 	"reflect"
 	"sync"
-	"time"
 )
 
 // Signal defines the possible signal values one dependency graph node can send to another
@@ -13,7 +11,7 @@ import (
 //  to each signal value for each access procedure in each dependency node.
 // EXAMPLE: an example reaction to an abort signal could be "Abort Chain/Tree" where the dependents
 // 	and their dependents, etc. all abort their operations if a signal value from a dependency node
-// 	is an 'Abort' signal.
+// 	is an 'Abort' signal (see AbortChain).
 type Signal int
 
 const (
@@ -81,25 +79,67 @@ type DGNode interface {
 }
 
 // Graph can be either UI DDAG, Temporal DAG or VDG
+//
+// CONCURRENCY: all Graph methods are safe to call from multiple goroutines,
+// including structural changes (AddRealNode, AddRealEdge, AddVUI, RemoveVUI,
+// AddVDG, RemoveVDG) made while nodes are executing. Structural changes are
+// serialized by a write lock; readers such as Dependents, Dependencies,
+// GetAdjacents and Nodes take a read lock and return a snapshot copy, so a
+// result reflects the graph at a single point in time but may be stale by the
+// time it is used.
+// Signaling maps are replaced rather than mutated in place (copy-on-write), so a
+// map previously returned by ListSignals or ListSignalers is never modified by
+// the graph afterwards.
+// IMPORTANT: Top and VDG are exported for inspection only. Accessing them
+// directly bypasses the lock; use Nodes, Dependencies and VDGs instead whenever
+// the graph may be changed concurrently, and never modify them directly.
+// Alongside Top the graph keeps an ID-indexed adjacency index (ID -> node,
+// dependencies and dependents), so lookups, edge insertion and node removal
+// are O(degree) rather than scans of Top.
 type Graph struct {
-	DS  CDS
+	DS  CDS // the default CDS (see RegisterCDS for more CDSs)
 	Top map[DGNode][]DGNode
 	VDG []*VDG
+
+	mu       sync.RWMutex
+	nodes    map[int]DGNode // node id -> node (the key used in Top)
+	adj      adjacency
+	acyclic  *topoOrder          // non-nil when cycle-forming edges are rejected
+	signals  SignalBackend       // creates the signaling channels of new edges (see SetSignalBackend)
+	channels *ChannelBackend     // the backend used when signals is not set (created lazily)
+	states   map[int]Signal      // node id -> last recorded state (see SetState)
+	images   map[int]image       // node id -> section before the node started (see restoreLists)
+	sending  map[int]int         // node id -> final signals being sent (see finish)
+	signaled map[int]bool        // nodes whose final signal an abort chain sent (see finish)
+	ids      IDAllocator         // used by NextID (nil means the default allocator)
+	watchdog *Watchdog           // tracks blocked nodes (see SetWatchdog)
+	cdss     map[string]CDS      // named CDSs (see RegisterCDS)
+	compat   CompatibilityMatrix // which access classes commute (see SetCompatibility)
 }
 
 // NewGraph creates a new empty graph
 func NewGraph() *Graph {
 	return &Graph{
-		Top: make(map[DGNode][]DGNode),
-		VDG: make([]*VDG, 0),
+		Top:   make(map[DGNode][]DGNode),
+		VDG:   make([]*VDG, 0),
+		nodes: make(map[int]DGNode),
+		adj:   newAdjacency(),
 	}
 }
 
+// NewGraphWithAllocator creates a new empty graph that generates ids with the given allocator
+func NewGraphWithAllocator(ids IDAllocator) *Graph {
+	g := NewGraph()
+	g.ids = ids
+
+	return g
+}
+
+// SingleUIGraph creates a graph with cds as its default CDS and a single UI
+// that covers all of it (see SingleUIGraphs for multiple CDSs)
 func SingleUIGraph(cds CDS) (*Graph, error) {
-	graph := &Graph{
-		Top: make(map[DGNode][]DGNode),
-		VDG: make([]*VDG, 0),
-	}
+	graph := NewGraph()
+	graph.DS = cds
 
 	edges := cds.ListEdges()
 	nodes := cds.ListNodes()
@@ -116,6 +156,9 @@ func SingleUIGraph(cds CDS) (*Graph, error) {
 
 // AddVDG ...
 func (g *Graph) AddVDG(v *VDG) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
 	// check if VDG already exists in graph
 	for _, vdg := range g.VDG {
 		if vdg == v {
@@ -130,28 +173,93 @@ func (g *Graph) AddVDG(v *VDG) error {
 
 // RemoveVDG ...
 func (g *Graph) RemoveVDG(v *VDG) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
 	for i, vdg := range g.VDG {
 		if vdg == v {
 			g.VDG = append(g.VDG[:i], g.VDG[i+1:]...)
+			break
 		}
 	}
 }
 
-// GenID ...
+// VDGs returns a snapshot of the VDGs registered with the graph
+func (g *Graph) VDGs() []*VDG {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	list := make([]*VDG, len(g.VDG))
+	copy(list, g.VDG)
+
+	return list
+}
+
+// Nodes returns a snapshot of all nodes in the graph
+func (g *Graph) Nodes() []DGNode {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	list := make([]DGNode, 0, len(g.nodes))
+	for _, id := range g.adj.ids() {
+		list = append(list, g.nodes[id])
+	}
+
+	return list
+}
+
+// Node returns the node with the given id, if it is in the graph
+func (g *Graph) Node(id int) (DGNode, bool) {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	n, ok := g.nodes[id]
+	return n, ok
+}
+
+// init lazily creates the adjacency index for graphs that were not
+// created with NewGraph; must be called with the write lock held
+func (g *Graph) init() {
+	if g.Top == nil {
+		g.Top = make(map[DGNode][]DGNode)
+	}
+	if g.nodes == nil {
+		g.nodes = make(map[int]DGNode)
+		g.adj = newAdjacency()
+	}
+}
+
+// GenID is NextID for allocators that cannot run out of ids (e.g. the
+// default Counter); it panics if the allocator fails
 func (g *Graph) GenID() int {
-	rand.Seed(time.Now().UnixNano())
-	id := rand.Int()
-	for n := range g.Top {
-		if n.ID() == id {
-			id = g.GenID()
-		}
+	id, err := g.NextID()
+	if err != nil {
+		panic(err)
 	}
 	return id
 }
 
+// NextID returns the next id of the graph's IDAllocator that is not in use in the graph
+func (g *Graph) NextID() (int, error) {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	return g.nextNodeID()
+}
+
+func (g *Graph) nextNodeID() (int, error) {
+	return nextID(g.ids, func(id int) bool {
+		_, ok := g.nodes[id]
+		return ok
+	})
+}
+
 // IsLeafBoundary ...
 func (g *Graph) IsLeafBoundary(n DGNode) bool {
-	if len(g.Dependencies(n)) == 0 {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	if len(g.adj.out[n.ID()]) == 0 {
 		return true
 	}
 
@@ -160,7 +268,10 @@ func (g *Graph) IsLeafBoundary(n DGNode) bool {
 
 // IsRootBoundary ...
 func (g *Graph) IsRootBoundary(n DGNode) bool {
-	if len(g.Dependents(n)) == 0 {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	if len(g.adj.in[n.ID()]) == 0 {
 		return true
 	}
 
@@ -169,53 +280,77 @@ func (g *Graph) IsRootBoundary(n DGNode) bool {
 
 // SignalsAndSignalers will udpate the SignalingMaps and SignalsMaps for all DGNodes in the graph
 func (g *Graph) SignalsAndSignalers() {
-
-	// for all nodes in the graph
-	for n, l := range g.Top {
-		// create its SignalersMap
-		sm := make(SignalingMap)
-		deps := g.Dependents(n)
-		for _, d := range deps {
-			c := make(chan NodeSignal)
-			sm[d.ID()] = c
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	// create every SignalingMap first, so that each SignalsMap can be
+	// built from the dependencies' new signalers
+	b := g.backend()
+	signalers := make(map[int]SignalingMap)
+	receivers := make(map[int]SignalsMap)
+	for id := range g.nodes {
+		signalers[id] = make(SignalingMap)
+		receivers[id] = make(SignalsMap)
+	}
+	for id := range g.nodes {
+		for d := range g.adj.in[id] {
+			send, recv := b.Connect(id, d)
+			signalers[id][d] = send
+			receivers[d][id] = recv
 		}
+	}
 
+	for id, n := range g.nodes {
 		// create its SignalsMap
-		s := make(SignalsMap)
-		for _, dep := range l {
-			channels := dep.ListSignalers()
-			ch := channels[dep.ID()]
-			s[dep.ID()] = ch
-		}
+		s := receivers[id]
 
-		n.UpdateSignaling(sm, s)
+		n.UpdateSignaling(signalers[id], s)
 	}
 }
 
 // BasicSignalHandler is the basic function type for handling signals from a dependency node
 // Used in total-blocking, to call wg.Done() on certain Signal Values and return.
 // will not allow for more complex signal handling e.g. handling an Abort or AbortRetry with more resilience (use with caution)
-type BasicSignalHandler func(<-chan NodeSignal, sync.WaitGroup)
+// NOTE: the WaitGroup is passed by reference, so that wg.Done() reaches the WaitGroup TotalBlock waits on.
+// Deprecated: use a SignalHandler (see handlers.go) instead.
+type BasicSignalHandler func(<-chan NodeSignal, *sync.WaitGroup)
 
 // TotalBlock is the most basic format for signal checking
 // (used when a node wants to simply totally-block all further operations until its dependencies have signaled)
 // as it only accepts a BasicSignalHandler it will not be a very powerful form of blocking (only use if lazy)
+// Deprecated: use Block with a SignalHandler (e.g. CompletionPolicy()) instead.
 func (g *Graph) TotalBlock(nodeID int, handler BasicSignalHandler) bool {
 	var wg sync.WaitGroup
 
-	for n := range g.Top {
-		if n.ID() == nodeID {
-			depSignals := n.ListSignals()
-			for _, channel := range depSignals {
-				wg.Add(1)
-				go handler(channel, wg)
-			}
-			break
+	// the signals are read under the lock, but the node must not hold
+	// the lock while it blocks
+	var depSignals SignalsMap
+	g.mu.RLock()
+	n, ok := g.nodes[nodeID]
+	if ok {
+		depSignals = n.ListSignals()
+	}
+	w := g.watchdog
+	g.mu.RUnlock()
+
+	if ok {
+		ids := make([]int, 0, len(depSignals))
+		for id := range depSignals {
+			ids = append(ids, id)
 		}
+		w.begin(n, g, ids)
+		defer w.end(nodeID)
+	}
+
+	g.recordState(nodeID, Waiting)
+	for _, channel := range depSignals {
+		wg.Add(1)
+		go handler(channel, &wg)
 	}
 
 	// Virtual Node blocks/spins
 	wg.Wait()
+	g.recordState(nodeID, Started)
 
 	return true
 }
@@ -229,119 +364,136 @@ func (g *Graph) AddRealNode(node DGNode) (DGNode, error) {
 		return newNode, fmt.Errorf("Node type is not comparable and cannot be used in the graph topology. \n Try removing any slices, maps, and functions from struct definition.")
 	}
 
-	if _, ok := g.Top[node]; !ok {
-		g.Top[node] = []DGNode{}
-	} else {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	return g.addNode(node)
+}
+
+// addNode inserts a node into Top and the adjacency index
+func (g *Graph) addNode(node DGNode) (DGNode, error) {
+	var newNode DGNode
+	g.init()
+
+	if _, ok := g.nodes[node.ID()]; ok {
 		return newNode, fmt.Errorf("Node already exists in Dependency Graph.")
 	}
 
-	for n := range g.Top {
-		if n.ID() == node.ID() {
-			newNode = n
-		}
+	g.Top[node] = []DGNode{}
+	g.nodes[node.ID()] = node
+	g.adj.addNode(node.ID())
+	if g.acyclic != nil {
+		g.acyclic.addNode(node.ID())
 	}
-	return newNode, nil
+
+	return node, nil
 }
 
 // AddRealEdge will create an edge and an appropriate signaling channel between nodes
-func (g *Graph) AddRealEdge(source int, dest DGNode) {
-
-	for i, k := range g.Top {
-		if i.ID() == source {
-			if !contains(k, dest) {
-				k = append(k, dest)
-				g.Top[i] = k
-
-				// update SignalingMap for destination
-				depSig := dest.ListSignalers()
-				depS := dest.ListSignals()
-				depSig[i.ID()] = make(chan NodeSignal)
-				dest.UpdateSignaling(depSig, depS)
-
-				// update SignalsMap for source
-				signals := i.ListSignals()
-				signalers := i.ListSignalers()
-				for j, v := range dest.ListSignalers() {
-					if j == i.ID() {
-						signals[dest.ID()] = v
-						break
-					}
-				}
-				i.UpdateSignaling(signalers, signals)
-			}
+// (the source node becomes a dependent of the destination node).
+// If the graph rejects cycles (see RejectCycles) and the edge would create one,
+// no edge is added and a *CycleError is returned.
+func (g *Graph) AddRealEdge(source int, dest DGNode) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.init()
+	i, ok := g.nodes[source]
+	if !ok {
+		return fmt.Errorf("Source node does not exist in Dependency Graph.")
+	}
+	d, ok := g.nodes[dest.ID()]
+	if !ok {
+		return fmt.Errorf("Destination node does not exist in Dependency Graph.")
+	}
+
+	return g.addEdge(i, d)
+}
+
+// addEdge adds the edge `i -> d` (i depends on d) and its signaling channel;
+// must be called with the write lock held
+func (g *Graph) addEdge(i, d DGNode) error {
+	if g.adj.hasEdge(i.ID(), d.ID()) {
+		return nil
+	}
+	if g.acyclic != nil {
+		if cycle := g.acyclic.insertEdge(g.adj, i.ID(), d.ID()); cycle != nil {
+			return &CycleError{Path: cycle}
 		}
 	}
+
+	g.Top[i] = append(g.Top[i], d)
+	g.adj.addEdge(i.ID(), d.ID())
+
+	// update SignalingMap for destination
+	send, recv := g.backend().Connect(d.ID(), i.ID())
+	depSig := copySignaling(d.ListSignalers())
+	depSig[i.ID()] = send
+	d.UpdateSignaling(depSig, d.ListSignals())
+
+	// update SignalsMap for source
+	signals := copySignals(i.ListSignals())
+	signals[d.ID()] = recv
+	i.UpdateSignaling(i.ListSignalers(), signals)
+
+	return nil
 }
 
 // CycleDetect will check whether a graph has cycles or not
 func (g *Graph) CycleDetect() bool {
-	var seen []DGNode
-	var done []DGNode
-
-	for i := range g.Top {
-		if !contains(done, i) {
-			result, d := g.cycleDfs(i, seen, done)
-			done = d
-			if result {
-				return true
-			}
-		}
-	}
-	return false
+	return g.Cycle() != nil
 }
 
-// AllowedProcedure checks whether or not an access procedure is allowed to act on a node ...
-func (g *Graph) AllowedProcedure(node DGNode, procedure AccessType) bool {
-	allowed := false
-	for _, p := range node.ListProcedures() {
-		if p.ID() == procedure.ID() {
-			allowed = true
-		}
+// Cycle returns a *CycleError describing one cycle in the graph,
+// or nil if the graph is acyclic
+func (g *Graph) Cycle() error {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	if cycle := g.adj.findCycle(); cycle != nil {
+		return &CycleError{Path: cycle}
 	}
 
-	return allowed
+	return nil
 }
 
-// Recursive Depth-First-Search; used for Cycle Detection
-func (g *Graph) cycleDfs(start DGNode, seen, done []DGNode) (bool, []DGNode) {
-	seen = append(seen, start)
-	adj := g.Top[start]
-	for _, v := range adj {
-		if contains(done, v) {
-			continue
-		}
+// RejectCycles turns on (or off) the rejection of cycle-forming edges:
+// while on, AddRealEdge refuses any edge that would create a cycle.
+// Turning it on fails with a *CycleError if the graph already has a cycle.
+func (g *Graph) RejectCycles(enable bool) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
 
-		if contains(seen, v) {
-			return true, done
-		}
+	if !enable {
+		g.acyclic = nil
+		return nil
+	}
 
-		if result, done := g.cycleDfs(v, seen, done); result {
-			return true, done
-		}
+	g.init()
+	order, cycle := newTopoOrder(g.adj)
+	if cycle != nil {
+		return &CycleError{Path: cycle}
 	}
-	seen = seen[:len(seen)-1]
-	done = append(done, start)
-	return false, done
+	g.acyclic = order
+
+	return nil
+}
+
+// AllowedProcedure checks whether or not an access procedure is allowed to act on a node ...
+// (see Guard to enforce it)
+func (g *Graph) AllowedProcedure(node DGNode, procedure AccessType) bool {
+	return allowed(node, procedure)
 }
 
 // GetAdjacents will return the list of nodes that a node is connected too
 func (g *Graph) GetAdjacents(node DGNode) []DGNode {
-	var list []DGNode
+	g.mu.RLock()
+	defer g.mu.RUnlock()
 
-	for n, l := range g.Top {
-		if n.ID() == node.ID() {
-			// Add all dependents to list
-			for n2, l2 := range g.Top {
-				if contains(l2, n) {
-					list = append(list, n2)
-				}
-			}
-			// Add all dependencies to list
-			for _, np := range l {
-				list = append(list, np)
-			}
-		}
-	}
+	// Add all dependents to list
+	list := g.dependents(node)
+	// Add all dependencies to list
+	list = append(list, g.dependencies(node)...)
 
 	return list
 }
@@ -350,84 +502,28 @@ func (g *Graph) GetAdjacents(node DGNode) []DGNode {
 // should only be called once when creating the UI dependency graph;
 // can be called with the creation of each UI if needed for
 // more "real-time" verification.
+// No two UIs of the same CDS may address the same Section (see VerifyUniqueness).
 func (g *Graph) TotalityUnique() bool {
-	// grab all UI nodes
-	var uiSlice []DGNode
-	for i := range g.Top {
-		if i.GetType() == UINode {
-			uiSlice = append(uiSlice, i)
-		}
-	}
-
-	var done []DGNode
-
-	// for every UI Node
-	for i, n := range uiSlice {
-		// compare it against every other UI node
-		for j, n2 := range uiSlice {
-			if !contains(done, n2) {
-				if j != i {
-					if reflect.DeepEqual(n, n2) {
-						return false
-					}
-				}
-			}
-		}
-		done = append(done, n)
-	}
+	g.mu.RLock()
+	defer g.mu.RUnlock()
 
-	return true
+	return !hasViolation(g.uniquenessConflicts(func(string) bool { return true }), TotalityViolation)
 }
 
-// Covered returns true if all CDS nodes and edges are covered
+// Covered returns true if all nodes and edges of every CDS of the graph are
+// covered (see CoveredCDS); a graph without a CDS is never covered
 func (g *Graph) Covered() bool {
-	// grab all UI nodes
-	var uiSlice []UI
-	for v := range g.Top {
-		if v.GetType() == UINode {
-			uiSlice = append(uiSlice, v.(UI))
-		}
-	}
-
-	// grab all CDS nodes and edges
-	ds := g.DS
-	nodes := ds.ListNodes()
-	edges := ds.ListEdges()
-
-FIRST:
-	// for every node in the CDS
-	for _, v := range nodes {
-		// check that at least one UI contains it
-		for _, u := range uiSlice {
-			s := u.GetSection()
-			uiCDSNodesPointer := s.ListNodes()
-			uiCDSNodes := *uiCDSNodesPointer
-			// if UI contains node; check next CDS node
-			if ContainsNode(uiCDSNodes, v) {
-				continue FIRST
-			}
-		}
+	g.mu.RLock()
+	defer g.mu.RUnlock()
 
-		// if CDS node is checked in every UI and does not show up
+	names := g.cdsNames()
+	if len(names) == 0 {
 		return false
 	}
-
-SECOND:
-	// for every edge in the CDS
-	for _, v := range edges {
-		// check that at least one UI contains it
-		for _, u := range uiSlice {
-			s := u.GetSection()
-			uiCDSEdgesPointer := s.ListEdges()
-			uiCDSEdges := *uiCDSEdgesPointer
-			// if UI contains edge; check next CDS edge
-			if ContainsEdge(uiCDSEdges, v) {
-				continue SECOND
-			}
+	for _, name := range names {
+		if !g.covered(name) {
+			return false
 		}
-
-		// if CDS edge is checked in every UI and does not show up
-		return false
 	}
 
 	return true
@@ -441,27 +537,15 @@ func (g *Graph) AddVUI(node UI) (DGNode, error) {
 		return newNode, fmt.Errorf("Not a virtual node.")
 	}
 
-	var nodeSlice []DGNode
-	for n := range g.Top {
-		nodeSlice = append(nodeSlice, n)
-	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
 
-	if !contains(nodeSlice, node) {
-		g.Top[node.(DGNode)] = []DGNode{}
-	} else {
-		return newNode, fmt.Errorf("Node already exists in Dependency Graph")
-	}
-
-	for n := range g.Top {
-		if n.ID() == node.ID() {
-			newNode = n
-		}
-	}
-
-	return newNode, nil
+	return g.addNode(node)
 }
 
 // RemoveVUI ...
+// Removal is refused while any dependent of the VUI may be waiting on it
+// (see RemoveRealNode), as retiring its channels would release the dependent.
 func (g *Graph) RemoveVUI(n DGNode) error {
 	node, ok := n.(UI)
 	if !ok {
@@ -472,42 +556,158 @@ func (g *Graph) RemoveVUI(n DGNode) error {
 		return fmt.Errorf("Not a virtual node")
 	}
 
-	for n1 := range g.Top {
-		if n1.ID() == n.ID() {
-			if len(g.Dependencies(n1)) != 0 {
-				return fmt.Errorf("VUI node still has dependencies")
-			}
-		}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	n1, ok := g.nodes[n.ID()]
+	if !ok {
+		return nil
 	}
 
-	// Remove VUI from Signals maps in depedent nodes
-	for n1 := range g.Top {
-		if n1.ID() == n.ID() {
-			for n2, l := range g.Top {
-				if contains(l, n1) {
-					signals := n2.ListSignals()
-					delete(signals, n1.ID())
-					n2.UpdateSignaling(n2.ListSignalers(), signals)
-				}
-			}
-		}
+	if len(g.adj.out[n1.ID()]) != 0 {
+		return fmt.Errorf("VUI node still has dependencies")
+	}
+	if waiting := g.waitingDependents(n1.ID()); len(waiting) > 0 {
+		return fmt.Errorf("Node %d still has waiting dependents %v. Cannot be deleted.", n1.ID(), waiting)
+	}
+
+	g.removeNode(n1)
+
+	return nil
+}
+
+// RemoveRealNode removes a node, every edge that touches it and their signaling
+// channels from the graph (e.g. when a data structure is re-partitioned).
+// Removal is refused while any dependent of the node may be waiting on it
+// (i.e. its state is Waiting, or was never recorded, see SetState).
+func (g *Graph) RemoveRealNode(n DGNode) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	node, ok := g.nodes[n.ID()]
+	if !ok {
+		return nil
+	}
+
+	if waiting := g.waitingDependents(node.ID()); len(waiting) > 0 {
+		return fmt.Errorf("Node %d still has waiting dependents %v. Cannot be deleted.", node.ID(), waiting)
+	}
+
+	g.removeNode(node)
+
+	return nil
+}
+
+// removeNode removes a node and all of its edges; must be called with the write lock held
+func (g *Graph) removeNode(node DGNode) {
+	// Remove node from Top lists and Signals maps in dependent nodes
+	for d := range g.adj.in[node.ID()] {
+		g.removeEdge(g.nodes[d], node)
+	}
+	// Remove node from Signaling maps in dependency nodes
+	for d := range g.adj.out[node.ID()] {
+		g.removeEdge(node, g.nodes[d])
 	}
 
 	// remove node from graph
-	delete(g.Top, n)
+	delete(g.Top, node)
+	delete(g.nodes, node.ID())
+	g.forget(node.ID())
+	releaseID(g.ids, node.ID())
+	g.adj.removeNode(node.ID())
+	if g.acyclic != nil {
+		g.acyclic.removeNode(node.ID())
+	}
+}
+
+// waiting reports whether a node may be blocked on its dependencies: its state
+// is Waiting, or was never recorded; must be called with the lock held
+func (g *Graph) waiting(id int) bool {
+	s, ok := g.states[id]
+	return !ok || s == Waiting
+}
+
+// blocked reports whether a node is recorded as Waiting, i.e. it is blocked
+// on its dependencies (see Block); must be called with the lock held
+func (g *Graph) blocked(id int) bool {
+	s, ok := g.states[id]
+	return ok && s == Waiting
+}
+
+// waitingDependents returns the dependents of a node that may be waiting on
+// it (sorted); must be called with the lock held
+func (g *Graph) waitingDependents(id int) []int {
+	var waiting []int
+	for _, d := range sortedSet(g.adj.in[id]) {
+		if g.waiting(d) {
+			waiting = append(waiting, d)
+		}
+	}
+	return waiting
+}
+
+// RemoveRealEdge removes an edge and its signaling channel from the graph
+// (the source node no longer depends on the destination node).
+// Removal is refused while the source node may be waiting on the destination
+// (see RemoveRealNode).
+func (g *Graph) RemoveRealEdge(source int, dest DGNode) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	i, ok := g.nodes[source]
+	if !ok {
+		return fmt.Errorf("Source node does not exist in Dependency Graph.")
+	}
+	d, ok := g.nodes[dest.ID()]
+	if !ok {
+		return fmt.Errorf("Destination node does not exist in Dependency Graph.")
+	}
+	if !g.adj.hasEdge(source, d.ID()) {
+		return nil
+	}
+	if g.waiting(source) {
+		return fmt.Errorf("Node %d may still be waiting on node %d. Cannot remove the edge.", source, d.ID())
+	}
+
+	g.removeEdge(i, d)
 
 	return nil
 }
 
+// removeEdge removes the edge `source -> dest` from Top, the adjacency index
+// and both signaling maps, and retires its channel; must be called with the
+// write lock held
+func (g *Graph) removeEdge(source, dest DGNode) {
+	g.Top[source] = removeByID(g.Top[source], dest.ID())
+	g.adj.removeEdge(source.ID(), dest.ID())
+
+	// update SignalingMap for destination
+	depSig := copySignaling(dest.ListSignalers())
+	delete(depSig, source.ID())
+	dest.UpdateSignaling(depSig, dest.ListSignals())
+
+	// update SignalsMap for source
+	signals := copySignals(source.ListSignals())
+	delete(signals, dest.ID())
+	source.UpdateSignaling(source.ListSignalers(), signals)
+
+	g.backend().Disconnect(dest.ID(), source.ID())
+}
+
 // Dependents ...
 func (g *Graph) Dependents(n DGNode) []DGNode {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	return g.dependents(n)
+}
+
+func (g *Graph) dependents(n DGNode) []DGNode {
 	var list []DGNode
 
-	for i, v := range g.Top {
-		if i.ID() != n.ID() {
-			if contains(v, n) {
-				list = append(list, i)
-			}
+	for id := range g.adj.in[n.ID()] {
+		if id != n.ID() {
+			list = append(list, g.nodes[id])
 		}
 	}
 
@@ -516,12 +716,20 @@ func (g *Graph) Dependents(n DGNode) []DGNode {
 
 // Dependencies ...
 func (g *Graph) Dependencies(n DGNode) []DGNode {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	return g.dependencies(n)
+}
+
+func (g *Graph) dependencies(n DGNode) []DGNode {
 	var list []DGNode
 
-	v, ok := g.Top[n]
+	node, ok := g.nodes[n.ID()]
 	if !ok {
 		return list
 	}
+	v := g.Top[node]
 
 	for _, p := range v {
 		list = append(list, p)
@@ -19,6 +19,11 @@ func (a AddTreeNode) Priority() int {
 	return 3
 }
 
+// Class ...
+func (a AddTreeNode) Class() fabric.AccessClass {
+	return fabric.InsertClass
+}
+
 // Commit ...
 func (a AddTreeNode) Commit(n fabric.DGNode) error {
 
@@ -58,8 +63,33 @@ func (a AddTreeNode) Commit(n fabric.DGNode) error {
 	return nil
 }
 
-// Rollback ...
+// Rollback removes the nodes that were added to a section: np are the nodes of
+// the section before the procedure ran (see fabric.UndoLog)
 func (a AddTreeNode) Rollback(np fabric.RestoreNodes, el fabric.RestoreEdges) error {
+	if len(np) == 0 {
+		return nil
+	}
+	first, ok := np[0].(*TreeNode)
+	if !ok || first.tree == nil {
+		return fmt.Errorf("Node %d is not a tree node. Cannot roll back.", np[0].ID())
+	}
+	t := first.tree
+	s := sectionOf(t.sections, first.ID())
+	if s == nil {
+		// no node was added to the section
+		return nil
+	}
+
+	nodes := make(fabric.NodeList, 0, len(np))
+	for _, n := range *s.ListNodes() {
+		if containsNode(fabric.NodeList(np), n.ID()) {
+			nodes = append(nodes, n)
+		} else {
+			deleteNode(t, n.ID())
+		}
+	}
+	s.UpdateNodeList(&nodes)
+
 	return nil
 }
 
@@ -76,6 +106,11 @@ func (a AddTreeEdge) Priority() int {
 	return 2
 }
 
+// Class ...
+func (a AddTreeEdge) Class() fabric.AccessClass {
+	return fabric.InsertClass
+}
+
 // Commit ...
 func (a AddTreeEdge) Commit(n fabric.DGNode) error {
 	// Get the UI being affected
@@ -132,6 +167,11 @@ func (d DeleteTreeEntity) Priority() int {
 	return 1
 }
 
+// Class ...
+func (d DeleteTreeEntity) Class() fabric.AccessClass {
+	return fabric.DeleteClass
+}
+
 // Commit ...
 func (d DeleteTreeEntity) Commit(n fabric.DGNode) error {
 	// Get the UI being affected
@@ -188,6 +228,11 @@ func (r ReadTreeNode) Priority() int {
 	return 4
 }
 
+// Class ...
+func (r ReadTreeNode) Class() fabric.AccessClass {
+	return fabric.ReadClass
+}
+
 // Commit ...
 func (r ReadTreeNode) Commit(n fabric.DGNode) error {
 	// Get the UI being affected
@@ -244,6 +289,11 @@ func (u UpdateTreeNode) Priority() int {
 	return 5
 }
 
+// Class ...
+func (u UpdateTreeNode) Class() fabric.AccessClass {
+	return fabric.WriteClass
+}
+
 // Commit ...
 func (u UpdateTreeNode) Commit(n fabric.DGNode) error {
 	// Get the UI being affected
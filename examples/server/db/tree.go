@@ -2,8 +2,6 @@ package db
 
 import (
 	"fmt"
-	"math/rand"
-	"time"
 
 	"github.com/JKhawaja/fabric"
 )
@@ -14,6 +12,9 @@ type Tree struct {
 	Sections fabric.NodeList
 	Nodes    fabric.NodeList
 	Edges    fabric.EdgeList
+	IDs      *fabric.Counter // used for both node and edge ids
+
+	sections []fabric.Section // the sections nodes were created in (see CreateNode)
 }
 
 // NewSection takes a session id and creates a root node for a branch section
@@ -58,9 +59,24 @@ func (t *Tree) CreateNode(s fabric.Section, value interface{}) (fabric.Node, err
 	nodes = append(nodes, n)
 	s.UpdateNodeList(&nodes)
 
+	// remember the section, so that the node can be rolled back (see AddTreeNode)
+	if sectionOf(t.sections, n.ID()) == nil {
+		t.sections = append(t.sections, s)
+	}
+
 	return n, nil
 }
 
+// sectionOf returns the section a node is in (nil if none)
+func sectionOf(sections []fabric.Section, id int) fabric.Section {
+	for _, s := range sections {
+		if containsNode(*s.ListNodes(), id) {
+			return s
+		}
+	}
+	return nil
+}
+
 // TODO: this function will iterate through the sections node list twice,
 // rewrite function so it does everything it needs to on a single iteration of
 // the sections nodelist.
@@ -159,7 +175,9 @@ func (t *Tree) UpdateNodeValue(s fabric.Section, id int, value interface{}) erro
 
 // NewTree ...
 func NewTree() fabric.CDS {
-	t := &Tree{}
+	t := &Tree{
+		IDs: fabric.NewCounter(1),
+	}
 	var i interface{}
 	n := NewTreeNode(t, i)
 	t.Root = n
@@ -177,30 +195,23 @@ func NewTree() fabric.CDS {
 // GenNodeID ...
 // Generate an ID for a CDS Node
 func (t Tree) GenNodeID() int {
-	rand.Seed(time.Now().UnixNano())
-	id := rand.Int()
-	for _, n := range t.Nodes {
-		if n.ID() == id {
-			id = t.GenNodeID()
+	for {
+		id, _ := t.IDs.Next() // a Counter never fails
+		if !containsNode(t.Nodes, id) {
+			return id
 		}
 	}
-
-	return id
 }
 
 // GenEdgeID ...
 // Generate an ID for a CDS Edge
 func (t Tree) GenEdgeID() int {
-	rand.Seed(time.Now().UnixNano())
-	id := rand.Int()
-	for _, e := range t.Edges {
-		if e.ID() == id {
-			id = t.GenEdgeID()
+	for {
+		id, _ := t.IDs.Next() // a Counter never fails
+		if !containsEdge(t.Edges, id) {
+			return id
 		}
 	}
-
-	return id
-
 }
 
 // ListNodes ...
@@ -218,16 +229,26 @@ type TreeNode struct {
 	Id    int
 	Value interface{}
 	Imm   bool
+
+	tree *Tree // the tree the node was created in (nil if it is not a *Tree)
 }
 
 // NewTreeNode ...
 func NewTreeNode(c fabric.CDS, value interface{}) fabric.Node {
+	t, _ := c.(*Tree)
 	return &TreeNode{
 		Id:    c.GenNodeID(),
 		Value: value,
+		tree:  t,
 	}
 }
 
+// Snapshot returns a copy of the node (see fabric.UndoLog)
+func (t *TreeNode) Snapshot() fabric.Node {
+	n := *t
+	return &n
+}
+
 // ID ...
 func (t *TreeNode) ID() int {
 	return t.Id
@@ -255,6 +276,12 @@ func NewTreeEdge(c fabric.CDS, s, d fabric.Node) fabric.Edge {
 	}
 }
 
+// Snapshot returns a copy of the edge (see fabric.UndoLog)
+func (t *TreeEdge) Snapshot() fabric.Edge {
+	e := *t
+	return &e
+}
+
 // ID ...
 func (t *TreeEdge) ID() int {
 	return t.Id
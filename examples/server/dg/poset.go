@@ -34,8 +34,9 @@ func (v *VDGPoset) Order(node fabric.Virtual) error {
 		return err
 	}
 
-	for vnode := range v.VDG().Top {
-		if vnode.ID() != node.ID() {
+	for _, vnode := range v.VDG().Nodes() {
+		// nodes whose access procedures commute (e.g. two reads) can run at the same time
+		if vnode.ID() != node.ID() && v.VDG().Conflicts(vnode, node) {
 			if vnode.GetPriority() <= node.GetPriority() && !vnode.Started() {
 				// create an edge from all nodes with an equivalent or larger priority integer to this node
 				err := v.VDG().AddVirtualEdge(vnode.ID(), node)
@@ -53,6 +54,7 @@ func (v *VDGPoset) Order(node fabric.Virtual) error {
 
 		// TODO: currently the Order() method orders ALL Update()s in order of their creation,
 		// but the Update()s *only* need to be ordered if they are updating the *same* CDS node
+		// (the access types would have to know their target node to implement fabric.Invariant)
 	}
 
 	return nil
@@ -1,9 +1,9 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
-	"math/rand"
 	"net/http"
 	"strconv"
 	"sync"
@@ -14,33 +14,58 @@ import (
 	"github.com/JKhawaja/fabric/examples/server/dg"
 )
 
-// Global Session store
-var sessions []Session
+// Global Session store (handlers run concurrently, so it is only accessed with sessionsMu held)
+var (
+	sessionsMu sync.Mutex
+	sessions   []Session
+)
+
+// sessionIDs never hands out the id of a session that still exists (see deleteSession)
+var sessionIDs = fabric.NewRandomAllocator(time.Now().UnixNano())
+
+// guard only lets a virtual node run the access procedures it was created for
+var guard = fabric.NewGuard(false)
 
 // Session is a user session object ...
 type Session struct {
-	ID     int
-	VPoset fabric.VPoset
-	VUI    fabric.UI
+	ID       int
+	VPoset   fabric.VPoset
+	VUI      fabric.UI
+	Executor *fabric.Executor
+	Watchdog *fabric.Watchdog // logs requests of the session that are deadlocked, or blocked for too long
 }
 
+// spaces lets concurrent reads of a session's space run together, while updates run alone
+var spaces = fabric.NewSpaceLock(fabric.WriterPreference)
+
 // NewSession ...
 func NewSession(v fabric.VPoset) Session {
+	id := GenSessionID()
+
+	// node ids are only unique within a VDG, so every session has its own watchdog
+	watchdog := fabric.NewWatchdog(5*time.Second, func(r fabric.WatchdogReport) {
+		log.Printf("watchdog (session %d): %v", id, r)
+	})
+	v.VDG().SetWatchdog(watchdog)
+	watchdog.Start()
+
+	// a failed request rolls back what its access procedures did to the tree
+	e := fabric.NewVDGExecutor(v.VDG())
+	e.Locks = spaces
+	e.Undo = true
+
 	return Session{
-		ID:     GenSessionID(),
-		VPoset: v,
+		ID:       id,
+		VPoset:   v,
+		Executor: e,
+		Watchdog: watchdog,
 	}
 }
 
 // GenSessionID ...
 func GenSessionID() int {
-	rand.Seed(time.Now().UnixNano())
-	id := rand.Int()
-	for _, s := range sessions {
-		if s.ID == id {
-			id = GenSessionID()
-		}
-	}
+	// a RandomAllocator never runs out of ids
+	id, _ := sessionIDs.Next()
 	return id
 }
 
@@ -60,12 +85,14 @@ func getSession(r *http.Request) (Session, error) {
 	}
 
 	// Get Session object using id from global sessions store
+	sessionsMu.Lock()
 	for _, s := range sessions {
 		if s.ID == id {
 			sess = s
 			break
 		}
 	}
+	sessionsMu.Unlock()
 
 	if sess.ID == 0 {
 		return sess, fmt.Errorf("Session not found. Please create a new session.")
@@ -79,47 +106,11 @@ func getSession(r *http.Request) (Session, error) {
 // NOTE: a node should mark itself started before calling SignalCheck;
 // a node is considered blocked/spinning while SignalChecking, but it also has bounded itself
 // from being added more dependencies.
-func signalCheck(node fabric.Virtual) bool {
-	cont := true
-
-	depSignals := node.ListSignals()
-	var wg sync.WaitGroup
-	for _, channel := range depSignals {
-		// create signal handler for each dependency
-		wg.Add(1)
-		go func(c <-chan fabric.NodeSignal) {
-			// blocking select that waits for a signal from a dependency node
-			select {
-			case sig := <-c:
-				// NOTE: the switch cases could revolve around different access types, different signal values, and different UIs
-				switch sig.Value {
-				case fabric.Waiting:
-					// do nothing
-					// NOTE: this require our select statement to be inside an infinite for loop in order for this to work correctly
-				case fabric.Started:
-					// do nothing
-					// NOTE: this require our select statement to be inside an infinite for loop in order for this to work correctly
-				case fabric.Completed:
-					wg.Done()
-					return
-				case fabric.Aborted:
-					wg.Done()
-					return
-				case fabric.AbortRetry:
-					wg.Done()
-					break
-				case fabric.PartialAbort:
-					wg.Done()
-					return
-				}
-			}
-		}(channel)
-	}
-
-	// Virtual Node blocks/spins
-	wg.Wait()
-
-	return cont
+// The context stops the check (and aborts the node's dependents) if e.g. the client disconnects.
+func signalCheck(ctx context.Context, sess Session, node fabric.Virtual) bool {
+	// NOTE: the policy could react differently to different access types, different signal values, and different UIs
+	err := sess.Watchdog.AwaitContext(ctx, node, fabric.CompletionPolicy())
+	return err == nil
 }
 
 func createSession(c fabric.CDS, g *fabric.Graph) http.HandlerFunc {
@@ -133,7 +124,8 @@ func createSession(c fabric.CDS, g *fabric.Graph) http.HandlerFunc {
 		}
 
 		// wrap VDG in a VPOSET
-		vposet := dg.NewVDGPoset(vdg)
+		// only keep the edges needed to order the session's requests
+		vposet := fabric.ReducedV(dg.NewVDGPoset(vdg))
 
 		// create a Session
 		session := NewSession(vposet)
@@ -158,7 +150,9 @@ func createSession(c fabric.CDS, g *fabric.Graph) http.HandlerFunc {
 		session.VUI = vu
 
 		// add session to global sessions store
+		sessionsMu.Lock()
 		sessions = append(sessions, session)
+		sessionsMu.Unlock()
 
 		// return session id to user
 		w.Write([]byte(strconv.Itoa(session.ID)))
@@ -175,17 +169,21 @@ func deleteSession(g *fabric.Graph) http.HandlerFunc {
 		}
 
 		// block till VDG has completed by signal checking the root node ...
-		if signalCheck(sess.VPoset.VDG().Root) {
+		if signalCheck(r.Context(), sess, sess.VPoset.VDG().Root) {
 			// remove Session from global sessions store
+			sessionsMu.Lock()
 			for i, s := range sessions {
 				if s.ID == sess.ID {
 					sessions = append(sessions[:i], sessions[i+1:]...)
 					break
 				}
 			}
+			sessionsMu.Unlock()
 
 			// remove VDG
 			g.RemoveVDG(sess.VPoset.VDG())
+			sess.Watchdog.Stop()
+			sessionIDs.Release(sess.ID)
 
 			// Remove VUI
 			err = g.RemoveVUI(sess.VUI)
@@ -220,25 +218,27 @@ func createNode(c fabric.CDS, g *fabric.Graph) http.HandlerFunc {
 			return
 		}
 
-		// Start Virtual Node
-		v.Start()
-
-		// SignalCheck and then run logic
-		if signalCheck(v) {
+		// Run logic once the Virtual Node's dependencies have completed
+		err = sess.Executor.RunNodeContext(r.Context(), v, func(n fabric.DGNode) error {
 			val := r.URL.Query()
 			value, ok := val["value"]
 			if !ok {
-				w.Write([]byte("Please provide a value for the node."))
-				return
+				return fmt.Errorf("Please provide a value for the node.")
 			}
 
-			newNode, err := t.CreateNode(sess.VUI.GetSection(), value[0])
+			var newNode fabric.Node
+			err := guard.Invoke(n, db.CreateNode, func() (err error) {
+				newNode, err = t.CreateNode(sess.VUI.GetSection(), value[0])
+				return err
+			})
 			if err != nil {
-				w.Write([]byte(err.Error()))
-				return
+				return err
 			}
-			db.CreateNode.Commit(v.(fabric.DGNode))
 			w.Write([]byte(strconv.Itoa(newNode.ID())))
+			return nil
+		})
+		if err != nil {
+			w.Write([]byte(err.Error()))
 		}
 
 		// remove virtual node
@@ -268,11 +268,8 @@ func createEdge(c fabric.CDS, g *fabric.Graph) http.HandlerFunc {
 			return
 		}
 
-		// Start Virtual Node
-		v.Start()
-
-		// SignalCheck and then run logic
-		if signalCheck(v) {
+		// Run logic once the Virtual Node's dependencies have completed
+		err = sess.Executor.RunNodeContext(r.Context(), v, func(n fabric.DGNode) error {
 			val := r.URL.Query()
 			node1 := val["n1"]
 			node2 := val["n2"]
@@ -289,13 +286,19 @@ func createEdge(c fabric.CDS, g *fabric.Graph) http.HandlerFunc {
 				}
 			}
 
-			newEdge, err := t.CreateEdge(sess.VUI.GetSection(), first, second)
+			var newEdge fabric.Edge
+			err := guard.Invoke(n, db.CreateEdge, func() (err error) {
+				newEdge, err = t.CreateEdge(sess.VUI.GetSection(), first, second)
+				return err
+			})
 			if err != nil {
-				w.Write([]byte(err.Error()))
-				return
+				return err
 			}
-			db.CreateEdge.Commit(v.(fabric.DGNode))
 			w.Write([]byte(strconv.Itoa(newEdge.ID())))
+			return nil
+		})
+		if err != nil {
+			w.Write([]byte(err.Error()))
 		}
 
 		// remove virtual node
@@ -325,20 +328,22 @@ func removeNode(c fabric.CDS, g *fabric.Graph) http.HandlerFunc {
 			return
 		}
 
-		// Start Virtual Node
-		v.Start()
-
-		if signalCheck(v) {
+		// Run logic once the Virtual Node's dependencies have completed
+		err = sess.Executor.RunNodeContext(r.Context(), v, func(n fabric.DGNode) error {
 			val := r.URL.Query()
 			node := val["node"]
 			nodeID, _ := strconv.Atoi(node[0])
-			err := t.RemoveNode(sess.VUI.GetSection(), nodeID)
+			err := guard.Invoke(n, db.RemoveNode, func() error {
+				return t.RemoveNode(sess.VUI.GetSection(), nodeID)
+			})
 			if err != nil {
-				w.Write([]byte(err.Error()))
-				return
+				return err
 			}
-			db.RemoveNode.Commit(v.(fabric.DGNode))
 			w.Write([]byte("Node Removed successfully."))
+			return nil
+		})
+		if err != nil {
+			w.Write([]byte(err.Error()))
 		}
 
 		// remove virtual node
@@ -368,20 +373,22 @@ func removeEdge(c fabric.CDS, g *fabric.Graph) http.HandlerFunc {
 			return
 		}
 
-		// Start Virtual Node
-		v.Start()
-
-		if signalCheck(v) {
+		// Run logic once the Virtual Node's dependencies have completed
+		err = sess.Executor.RunNodeContext(r.Context(), v, func(n fabric.DGNode) error {
 			val := r.URL.Query()
 			edge := val["edge"]
 			edgeID, _ := strconv.Atoi(edge[0])
-			err := t.RemoveEdge(sess.VUI.GetSection(), edgeID)
+			err := guard.Invoke(n, db.RemoveEdge, func() error {
+				return t.RemoveEdge(sess.VUI.GetSection(), edgeID)
+			})
 			if err != nil {
-				w.Write([]byte(err.Error()))
-				return
+				return err
 			}
-			db.RemoveEdge.Commit(v.(fabric.DGNode))
 			w.Write([]byte("Edge removed successfully."))
+			return nil
+		})
+		if err != nil {
+			w.Write([]byte(err.Error()))
 		}
 
 		// remove virtual node
@@ -411,21 +418,24 @@ func readNodeValue(c fabric.CDS, g *fabric.Graph) http.HandlerFunc {
 			return
 		}
 
-		// Start Virtual Node
-		v.Start()
-
-		// Signalcheck and then run logic
-		if signalCheck(v) {
+		// Run logic once the Virtual Node's dependencies have completed
+		err = sess.Executor.RunNodeContext(r.Context(), v, func(n fabric.DGNode) error {
 			val := r.URL.Query()
 			node := val["node"]
 			nodeID, _ := strconv.Atoi(node[0])
-			value, err := t.ReadNodeValue(sess.VUI.GetSection(), nodeID)
+			var value interface{}
+			err := guard.Invoke(n, db.ReadNodeValue, func() (err error) {
+				value, err = t.ReadNodeValue(sess.VUI.GetSection(), nodeID)
+				return err
+			})
 			if err != nil {
-				w.Write([]byte(err.Error()))
-				return
+				return err
 			}
-			db.ReadNodeValue.Commit(v.(fabric.DGNode))
 			w.Write([]byte(value.(string)))
+			return nil
+		})
+		if err != nil {
+			w.Write([]byte(err.Error()))
 		}
 
 		// remove virtual node
@@ -455,22 +465,23 @@ func updateNodeValue(c fabric.CDS, g *fabric.Graph) http.HandlerFunc {
 			return
 		}
 
-		// Start Virtual Node
-		v.Start()
-
-		// SignalCheck and then run logic
-		if signalCheck(v) {
+		// Run logic once the Virtual Node's dependencies have completed
+		err = sess.Executor.RunNodeContext(r.Context(), v, func(n fabric.DGNode) error {
 			val := r.URL.Query()
 			node := val["node"]
 			value := val["value"]
 			nodeID, _ := strconv.Atoi(node[0])
-			err := t.UpdateNodeValue(sess.VUI.GetSection(), nodeID, value[0])
+			err := guard.Invoke(n, db.UpdateNodeValue, func() error {
+				return t.UpdateNodeValue(sess.VUI.GetSection(), nodeID, value[0])
+			})
 			if err != nil {
-				w.Write([]byte(err.Error()))
-				return
+				return err
 			}
-			db.UpdateNodeValue.Commit(v.(fabric.DGNode))
 			w.Write([]byte("Node updated successfully."))
+			return nil
+		})
+		if err != nil {
+			w.Write([]byte(err.Error()))
 		}
 
 		// remove virtual node
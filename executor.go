@@ -0,0 +1,282 @@
+package fabric
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+/*
+	Executor
+
+	The Executor is the runtime for the dependency graph interfaces: it takes
+	a Graph or VDG plus a function for each DGNode, and drives the signaling
+	that users otherwise have to write by hand for every node:
+
+		Start (virtual nodes) -> block on dependencies -> Started ->
+		procedure -> Completed (or Aborted)
+
+	Every node runs on its own goroutine once each of its dependencies has
+	signaled Completed (or, more generally, once the Executor's SignalHandler
+	lets it proceed). If a dependency aborts the node, the node does not run
+	its function and signals Aborted to its own dependents instead, so the
+	whole chain below a failed node unwinds.
+
+	RunContext and RunNodeContext stop nodes that are still blocked on their
+	dependencies when the context is done; those nodes abort (with a
+	*BlockError) and signal Aborted to their dependents.
+
+	With Undo set, the Executor records an UndoLog of every node's access
+	procedures before its function runs, and rolls it back if the function
+	fails (before the node signals Aborted). A node whose write sets cannot
+	be snapshotted (see UndoLog) aborts without running its function.
+
+	NOTE: the node functions should not signal the node's dependents
+	themselves (e.g. by calling an AccessType's Commit method), as the
+	Executor already emits the Started/Completed/Aborted signals for them.
+*/
+
+// NodeFunc is the work a node performs once all of its dependencies have completed
+type NodeFunc func(DGNode) error
+
+// ExecutionResult is the aggregate result of executing a dependency graph
+type ExecutionResult struct {
+	Completed []int                 // ids of the nodes that ran successfully (sorted)
+	Aborted   []int                 // ids of the nodes that failed or were aborted by a dependency (sorted)
+	Errors    map[int]error         // errors returned by the node functions (or a *BlockError), keyed by node id
+	Durations map[int]time.Duration // how long the function of every node that ran took, keyed by node id
+}
+
+// Cost returns the measured durations as a CostFunc (e.g. for CriticalPath);
+// nodes that did not run cost nothing
+func (r *ExecutionResult) Cost() CostFunc {
+	return func(n DGNode) time.Duration {
+		return r.Durations[n.ID()]
+	}
+}
+
+// Err returns an error summarizing the failed nodes, or nil if every node completed
+func (r *ExecutionResult) Err() error {
+	if len(r.Aborted) == 0 {
+		return nil
+	}
+
+	return fmt.Errorf("%d of %d nodes aborted (%d failed)", len(r.Aborted), len(r.Aborted)+len(r.Completed), len(r.Errors))
+}
+
+// executable is satisfied by the dependency graph types an Executor can run
+type executable interface {
+	nodeSource
+	executionOrder() ([]DGNode, error)
+	recordState(id int, s Signal)
+	finish(n DGNode, s Signal)
+	watcher() *Watchdog
+}
+
+// Executor runs the nodes of a Graph or VDG
+type Executor struct {
+	Default NodeFunc      // used for nodes that do not have their own function (optional)
+	Handler SignalHandler // how nodes react to their dependencies' signals (defaults to CompletionPolicy)
+	Locks   *SpaceLock    // locks the space of every node while its function runs (optional)
+	Undo    bool          // roll back the access procedures of a node whose function fails (see UndoLog)
+
+	source executable
+	mu     sync.Mutex
+	funcs  map[int]NodeFunc
+}
+
+// NewExecutor returns an Executor for the nodes of a Graph
+func NewExecutor(g *Graph) *Executor {
+	return &Executor{
+		source: g,
+		funcs:  make(map[int]NodeFunc),
+	}
+}
+
+// NewVDGExecutor returns an Executor for the nodes of a VDG
+func NewVDGExecutor(v *VDG) *Executor {
+	return &Executor{
+		source: v,
+		funcs:  make(map[int]NodeFunc),
+	}
+}
+
+// Handle assigns the function that will be run for the node with the given id
+func (e *Executor) Handle(id int, f NodeFunc) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.funcs[id] = f
+}
+
+func (e *Executor) handler(id int) NodeFunc {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if f, ok := e.funcs[id]; ok {
+		return f
+	}
+	return e.Default
+}
+
+// Run executes every node of the graph, each on its own goroutine, and
+// returns once all of them have completed or aborted.
+// Run fails before executing anything if the graph has a cycle or a node has no function.
+func (e *Executor) Run() (*ExecutionResult, error) {
+	return e.RunContext(context.Background())
+}
+
+// RunContext is Run with a context; nodes that are still blocked on their
+// dependencies when the context is done are aborted
+func (e *Executor) RunContext(ctx context.Context) (*ExecutionResult, error) {
+	nodes, err := e.source.executionOrder()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, n := range nodes {
+		if e.handler(n.ID()) == nil {
+			return nil, fmt.Errorf("No function assigned to node %d.", n.ID())
+		}
+	}
+
+	result := &ExecutionResult{
+		Errors:    make(map[int]error),
+		Durations: make(map[int]time.Duration),
+	}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+
+	for _, n := range nodes {
+		wg.Add(1)
+		go func(n DGNode) {
+			defer wg.Done()
+			completed, d, err := e.execute(ctx, n, e.handler(n.ID()))
+
+			mu.Lock()
+			defer mu.Unlock()
+			if d > 0 {
+				result.Durations[n.ID()] = d
+			}
+			if completed {
+				result.Completed = append(result.Completed, n.ID())
+			} else {
+				result.Aborted = append(result.Aborted, n.ID())
+			}
+			if err != nil {
+				result.Errors[n.ID()] = err
+			}
+		}(n)
+	}
+	wg.Wait()
+
+	sort.Ints(result.Completed)
+	sort.Ints(result.Aborted)
+
+	return result, nil
+}
+
+// RunNode executes a single node on the calling goroutine: it blocks until
+// the node's dependencies have signaled, runs f and signals the node's
+// dependents. This is useful when nodes are added to a graph one at a time
+// (e.g. a VDG node per request) rather than executed as a whole graph.
+// Returns the error of f, or an *AbortError if a dependency aborted the node.
+func (e *Executor) RunNode(n DGNode, f NodeFunc) error {
+	return e.RunNodeContext(context.Background(), n, f)
+}
+
+// RunNodeContext is RunNode with a context; if the context is done while the
+// node is blocked on its dependencies, the node aborts with a *BlockError
+func (e *Executor) RunNodeContext(ctx context.Context, n DGNode, f NodeFunc) error {
+	_, _, err := e.run(ctx, n, f)
+	return err
+}
+
+// execute drives the signaling for one node and reports whether it completed
+// and how long its function took; the returned error is only set if the
+// node's own function failed, or the node stopped blocking because the
+// context is done
+func (e *Executor) execute(ctx context.Context, n DGNode, f NodeFunc) (bool, time.Duration, error) {
+	completed, d, err := e.run(ctx, n, f)
+	if _, ok := err.(*AbortError); ok {
+		err = nil
+	}
+
+	return completed, d, err
+}
+
+func (e *Executor) run(ctx context.Context, n DGNode, f NodeFunc) (bool, time.Duration, error) {
+	// a virtual node must be marked as started before it blocks,
+	// so that no new dependencies can be added to it
+	if v, ok := n.(Virtual); ok {
+		v.Start()
+	}
+
+	h := e.Handler
+	if h == nil {
+		h = CompletionPolicy()
+	}
+	e.source.recordState(n.ID(), Waiting)
+	if err := await(ctx, n, h, e.source.watcher(), e.source); err != nil {
+		e.source.finish(n, Aborted)
+		return false, 0, err
+	}
+
+	if e.Locks != nil {
+		release, err := e.Locks.Lock(ctx, n)
+		if err != nil {
+			e.source.finish(n, Aborted)
+			return false, 0, err
+		}
+		defer release()
+	}
+
+	var undo *UndoLog
+	if e.Undo {
+		undo = NewUndoLog()
+		if err := undo.RecordNode(n); err != nil {
+			e.source.finish(n, Aborted)
+			return false, 0, err
+		}
+	}
+
+	e.source.recordState(n.ID(), Started)
+	n.Signal(nodeSignal(n, Started))
+	start := time.Now()
+	err := f(n)
+	d := time.Since(start)
+	if err != nil && undo != nil {
+		if rerr := undo.Rollback(); rerr != nil {
+			err = &RollbackError{Node: n.ID(), Err: err, Rollback: rerr}
+		}
+	}
+	if err != nil {
+		e.source.finish(n, Aborted)
+		return false, d, err
+	}
+	e.source.finish(n, Completed)
+
+	return true, d, nil
+}
+
+// executionOrder ...
+func (g *Graph) executionOrder() ([]DGNode, error) {
+	return g.TopologicalOrder()
+}
+
+// executionOrder ...
+func (g *VDG) executionOrder() ([]DGNode, error) {
+	order, err := g.TopologicalOrder()
+	if err != nil {
+		return nil, err
+	}
+
+	nodes := make([]DGNode, len(order))
+	for i, n := range order {
+		nodes[i] = n
+	}
+
+	return nodes, nil
+}
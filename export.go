@@ -0,0 +1,289 @@
+package fabric
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+)
+
+/*
+	Exporting Dependency Graphs
+
+	WriteDOT writes a Graph or VDG in the Graphviz DOT language, with the
+	nodes colored by their NodeType; e.g. `dot -Tsvg graph.dot > graph.svg`.
+	An edge `a -> b` means that a depends on b (the direction of Top).
+
+	Document (and MarshalJSON / WriteJSON) produce a stable JSON document:
+	nodes are sorted by id and edges by source then destination, so equal
+	graphs always produce equal documents (e.g. for golden-file tests).
+
+	LoadGraph rebuilds a Graph from a JSON document. As the document only
+	holds ids, the loader needs a NodeFactory for every NodeType in it to
+	create the user's own DGNode values.
+*/
+
+// String ...
+func (t NodeType) String() string {
+	switch t {
+	case UINode:
+		return "UI"
+	case TemporalNode:
+		return "Temporal"
+	case VirtualTemporalNode:
+		return "VirtualTemporal"
+	case VUINode:
+		return "VUI"
+	case VDGNode:
+		return "VDG"
+	}
+	return "Unknown"
+}
+
+// parseNodeType returns the NodeType with the given name (see String)
+func parseNodeType(name string) (NodeType, error) {
+	for _, nt := range []NodeType{UINode, TemporalNode, VirtualTemporalNode, VUINode, VDGNode, Unknown} {
+		if nt.String() == name {
+			return nt, nil
+		}
+	}
+	return Unknown, fmt.Errorf("Unknown node type %q.", name)
+}
+
+// GraphDocument is the JSON representation of a Graph or VDG
+type GraphDocument struct {
+	Nodes []NodeDocument `json:"nodes"`
+	Edges []EdgeDocument `json:"edges"`
+}
+
+// NodeDocument is the JSON representation of a DGNode
+type NodeDocument struct {
+	ID         int              `json:"id"`
+	Type       string           `json:"type"` // the NodeType's name (e.g. "UI")
+	Priority   int              `json:"priority"`
+	Procedures []int            `json:"procedures"`         // access type ids
+	Section    *SectionDocument `json:"section,omitempty"`  // UI and VUI nodes
+	CDS        string           `json:"cds,omitempty"`      // UI and VUI nodes of a named CDS
+	Roots      []int            `json:"roots,omitempty"`    // Temporal nodes
+	Subspace   *int             `json:"subspace,omitempty"` // VDG nodes
+}
+
+// SectionDocument is the JSON representation of a Section (CDS node and edge ids, sorted)
+type SectionDocument struct {
+	Nodes []int `json:"nodes"`
+	Edges []int `json:"edges"`
+}
+
+// EdgeDocument is the JSON representation of an edge (the source depends on the destination)
+type EdgeDocument struct {
+	Source      int `json:"source"`
+	Destination int `json:"destination"`
+}
+
+// NodeFactory creates a DGNode from its JSON representation
+type NodeFactory func(NodeDocument) (DGNode, error)
+
+func nodeDocument(n DGNode) NodeDocument {
+	doc := NodeDocument{
+		ID:         n.ID(),
+		Type:       n.GetType().String(),
+		Priority:   n.GetPriority(),
+		Procedures: make([]int, 0),
+	}
+	for _, p := range n.ListProcedures() {
+		doc.Procedures = append(doc.Procedures, p.ID())
+	}
+
+	switch v := n.(type) {
+	case Virtual:
+		if space := v.Subspace(); space != nil {
+			id := space.ID()
+			doc.Subspace = &id
+		}
+	case UI:
+		doc.Section = sectionDocument(v.GetSection())
+		doc.CDS = CDSOf(v)
+	case Temporal:
+		for _, r := range v.GetRoots() {
+			doc.Roots = append(doc.Roots, r.ID())
+		}
+	}
+
+	return doc
+}
+
+func sectionDocument(s Section) *SectionDocument {
+	if s == nil {
+		return nil
+	}
+
+	doc := &SectionDocument{
+		Nodes: make([]int, 0),
+		Edges: make([]int, 0),
+	}
+	if nodes := s.ListNodes(); nodes != nil {
+		for _, n := range *nodes {
+			doc.Nodes = append(doc.Nodes, n.ID())
+		}
+	}
+	if edges := s.ListEdges(); edges != nil {
+		for _, e := range *edges {
+			doc.Edges = append(doc.Edges, e.ID())
+		}
+	}
+	sort.Ints(doc.Nodes)
+	sort.Ints(doc.Edges)
+
+	return doc
+}
+
+// document must be called with the read lock held
+func (a adjacency) document(node func(id int) DGNode) *GraphDocument {
+	doc := &GraphDocument{
+		Nodes: make([]NodeDocument, 0, len(a.out)),
+		Edges: make([]EdgeDocument, 0),
+	}
+	for _, id := range a.ids() {
+		doc.Nodes = append(doc.Nodes, nodeDocument(node(id)))
+		for _, d := range sortedSet(a.out[id]) {
+			doc.Edges = append(doc.Edges, EdgeDocument{Source: id, Destination: d})
+		}
+	}
+
+	return doc
+}
+
+// Document returns the JSON representation of the graph
+func (g *Graph) Document() *GraphDocument {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	return g.adj.document(func(id int) DGNode { return g.nodes[id] })
+}
+
+// MarshalJSON encodes the graph's Document
+func (g *Graph) MarshalJSON() ([]byte, error) {
+	return json.Marshal(g.Document())
+}
+
+// WriteJSON writes the graph's Document as indented JSON
+func (g *Graph) WriteJSON(w io.Writer) error {
+	return writeJSON(w, g.Document())
+}
+
+// WriteDOT writes the graph in the Graphviz DOT language
+func (g *Graph) WriteDOT(w io.Writer) error {
+	return writeDOT(w, "Graph", g.Document())
+}
+
+// Document returns the JSON representation of the VDG
+func (g *VDG) Document() *GraphDocument {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	return g.adj.document(func(id int) DGNode { return g.nodes[id] })
+}
+
+// MarshalJSON encodes the VDG's Document
+func (g *VDG) MarshalJSON() ([]byte, error) {
+	return json.Marshal(g.Document())
+}
+
+// WriteJSON writes the VDG's Document as indented JSON
+func (g *VDG) WriteJSON(w io.Writer) error {
+	return writeJSON(w, g.Document())
+}
+
+// WriteDOT writes the VDG in the Graphviz DOT language
+func (g *VDG) WriteDOT(w io.Writer) error {
+	return writeDOT(w, "VDG", g.Document())
+}
+
+func writeJSON(w io.Writer, doc *GraphDocument) error {
+	b, err := json.MarshalIndent(doc, "", "\t")
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(b, '\n'))
+
+	return err
+}
+
+// dotColors are the fill colors of each NodeType in DOT output
+var dotColors = map[NodeType]string{
+	UINode:              "lightblue",
+	TemporalNode:        "palegreen",
+	VirtualTemporalNode: "palegreen",
+	VUINode:             "lightyellow",
+	VDGNode:             "plum",
+	Unknown:             "white",
+}
+
+func writeDOT(w io.Writer, name string, doc *GraphDocument) error {
+	b := bufio.NewWriter(w)
+
+	fmt.Fprintf(b, "digraph %s {\n", name)
+	fmt.Fprintf(b, "\tnode [style=filled];\n")
+	for _, n := range doc.Nodes {
+		t, _ := parseNodeType(n.Type)
+		color, ok := dotColors[t]
+		if !ok {
+			color = dotColors[Unknown]
+		}
+		style := "filled"
+		if t == VirtualTemporalNode || t == VUINode || t == VDGNode {
+			style = "filled,dashed"
+		}
+		fmt.Fprintf(b, "\t%d [label=\"%d\\n%s\", fillcolor=%s, style=\"%s\"];\n", n.ID, n.ID, n.Type, color, style)
+	}
+	for _, e := range doc.Edges {
+		fmt.Fprintf(b, "\t%d -> %d;\n", e.Source, e.Destination)
+	}
+	fmt.Fprintf(b, "}\n")
+
+	return b.Flush()
+}
+
+// LoadGraph rebuilds a Graph from its JSON representation, creating every
+// node with the factory for its NodeType
+func LoadGraph(r io.Reader, factories map[NodeType]NodeFactory) (*Graph, error) {
+	var doc GraphDocument
+	if err := json.NewDecoder(r).Decode(&doc); err != nil {
+		return nil, err
+	}
+
+	g := NewGraph()
+	for _, nd := range doc.Nodes {
+		t, err := parseNodeType(nd.Type)
+		if err != nil {
+			return nil, err
+		}
+		factory, ok := factories[t]
+		if !ok {
+			return nil, fmt.Errorf("No factory for node type %s (node %d).", nd.Type, nd.ID)
+		}
+		n, err := factory(nd)
+		if err != nil {
+			return nil, err
+		}
+		if n.ID() != nd.ID {
+			return nil, fmt.Errorf("Factory created node %d for node %d.", n.ID(), nd.ID)
+		}
+		if _, err := g.AddRealNode(n); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, e := range doc.Edges {
+		dest, ok := g.Node(e.Destination)
+		if !ok {
+			return nil, fmt.Errorf("Edge destination %d does not exist in Dependency Graph.", e.Destination)
+		}
+		if err := g.AddRealEdge(e.Source, dest); err != nil {
+			return nil, err
+		}
+	}
+
+	return g, nil
+}
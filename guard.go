@@ -0,0 +1,94 @@
+package fabric
+
+import (
+	"fmt"
+	"sync/atomic"
+)
+
+/*
+	Guarded Invocation
+
+	A DGNode lists the access procedures it may run (ListProcedures), but
+	nothing stops the code that runs on behalf of a node from calling
+	another procedure: a VDG node created for a read could run an update.
+
+	A Guard is the invocation path that enforces the list: Invoke only runs
+	an access procedure on behalf of a node whose ListProcedures contains
+	it. A violation is counted, and returned as a *PermissionError (or, in
+	strict mode, raised as a panic so that it cannot go unnoticed while
+	debugging).
+
+	Access procedures are ordinary functions of the CDS (with arbitrary
+	signatures), so Invoke takes the AccessType that describes the call and
+	a closure that makes it:
+
+		err := guard.Invoke(node, db.ReadNodeValue, func() error {
+			value, err = t.ReadNodeValue(section, id)
+			return err
+		})
+*/
+
+// PermissionError is returned when an access procedure is invoked on behalf of
+// a node that does not list it
+type PermissionError struct {
+	Node       int
+	AccessType int
+}
+
+// Error ...
+func (e *PermissionError) Error() string {
+	return fmt.Sprintf("Access type %d is not an access procedure of node %d.", e.AccessType, e.Node)
+}
+
+// Guard enforces the access procedures of DGNodes
+type Guard struct {
+	Strict bool // panic on violations instead of returning an error
+
+	violations int64
+}
+
+// NewGuard ...
+func NewGuard(strict bool) *Guard {
+	return &Guard{Strict: strict}
+}
+
+// allowed checks whether an access procedure is listed by a node
+func allowed(node DGNode, procedure AccessType) bool {
+	for _, p := range node.ListProcedures() {
+		if p.ID() == procedure.ID() {
+			return true
+		}
+	}
+	return false
+}
+
+// Check returns a *PermissionError (and counts a violation) if the node does
+// not list the access procedure; panics instead in strict mode
+func (g *Guard) Check(node DGNode, procedure AccessType) error {
+	if allowed(node, procedure) {
+		return nil
+	}
+
+	atomic.AddInt64(&g.violations, 1)
+	err := &PermissionError{Node: node.ID(), AccessType: procedure.ID()}
+	if g.Strict {
+		panic(err)
+	}
+
+	return err
+}
+
+// Invoke runs f (a call of the access procedure) on behalf of the node if the
+// node lists the access procedure (see Check)
+func (g *Guard) Invoke(node DGNode, procedure AccessType, f func() error) error {
+	if err := g.Check(node, procedure); err != nil {
+		return err
+	}
+
+	return f()
+}
+
+// Violations returns the number of violations the Guard has caught
+func (g *Guard) Violations() int64 {
+	return atomic.LoadInt64(&g.violations)
+}
@@ -0,0 +1,452 @@
+package fabric
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+/*
+	Signal Handlers
+
+	A node that blocks on its dependencies needs a reaction to every signal
+	value each dependency can send (see the Signal RECOMMENDATION). A
+	SignalHandler maps each signal to a Reaction:
+
+		KeepWaiting    - ignore the signal and keep waiting on the dependency
+		Proceed        - the dependency no longer holds the node back
+		Abort          - stop waiting and abort the node's own operation
+		Retry          - the dependency is retrying; pause (backoff) and keep waiting
+		HelpDependency - trigger a helping mechanism, then keep waiting
+
+	Policy is a reusable, table-driven SignalHandler; CompletionPolicy,
+	StartPolicy and BestEffortPolicy are built-in policies for the most
+	common reactions.
+
+	A final signal (Completed, Aborted or PartialAbort) always ends the wait
+	on a dependency, whatever the reaction to it, as nothing else will be
+	sent; a closed signal channel (a retired dependency) does as well.
+
+	Once a dependency has released the node (Proceed) or aborted it, its
+	channel keeps being drained in the background until the dependency sends
+	a final signal (Completed, Aborted or PartialAbort) so that the dependency
+	is never left blocked on an unbuffered signal channel.
+
+	Deadlines and Cancellation
+
+	AwaitContext, Graph.BlockContext and VDG.BlockContext stop blocking when
+	their context is done (e.g. a deadline passes, or an HTTP client
+	disconnects) and return a *BlockError listing the dependencies that were
+	still outstanding. The blocked node then signals Aborted to its own
+	dependents, so the whole chain below it unwinds instead of blocking
+	forever. NOTE: the Aborted signal is sent from a new goroutine, as the
+	dependents may not be receiving yet.
+
+	A node that Graph.Block or VDG.Block returns an *AbortError for has
+	signaled Aborted to its own dependents as well, before Block returns.
+*/
+
+// Reaction is what a blocked node does in response to a signal from one of its dependencies
+type Reaction int
+
+const (
+	// KeepWaiting ignores the signal and keeps waiting on the dependency
+	KeepWaiting Reaction = iota
+	// Proceed stops waiting on the dependency
+	Proceed
+	// Abort stops waiting on all dependencies and fails the block
+	Abort
+	// Retry pauses for the handler's backoff and keeps waiting on the dependency
+	Retry
+	// HelpDependency calls the handler's helping mechanism and keeps waiting on the dependency
+	HelpDependency
+)
+
+// SignalHandler decides how a blocked node reacts to the signals of its dependencies
+type SignalHandler interface {
+	// React returns the reaction to a signal from the dependency with the given id;
+	// retries is the number of Retry reactions already made for that dependency
+	React(dependency int, s NodeSignal, retries int) Reaction
+	// Backoff is how long to pause after the given (1-based) Retry reaction
+	Backoff(retry int) time.Duration
+	// Help is called for a HelpDependency reaction
+	Help(dependency int, s NodeSignal)
+}
+
+// Policy is a table-driven SignalHandler
+type Policy struct {
+	Reactions  map[Signal]Reaction                // signals that are not in the map keep the node waiting
+	MaxRetries int                                // Retry reactions allowed per dependency before aborting (0 means unlimited)
+	Delay      func(retry int) time.Duration      // backoff between retries (optional)
+	Helper     func(dependency int, s NodeSignal) // helping mechanism for HelpDependency reactions (optional)
+}
+
+// React ...
+func (p *Policy) React(dependency int, s NodeSignal, retries int) Reaction {
+	r, ok := p.Reactions[s.Value]
+	if !ok {
+		return KeepWaiting
+	}
+	if r == Retry && p.MaxRetries > 0 && retries >= p.MaxRetries {
+		return Abort
+	}
+	return r
+}
+
+// Backoff ...
+func (p *Policy) Backoff(retry int) time.Duration {
+	if p.Delay == nil {
+		return 0
+	}
+	return p.Delay(retry)
+}
+
+// Help ...
+func (p *Policy) Help(dependency int, s NodeSignal) {
+	if p.Helper != nil {
+		p.Helper(dependency, s)
+	}
+}
+
+// ExponentialBackoff returns a backoff function that doubles the delay
+// after every retry, starting at base and capped at max
+func ExponentialBackoff(base, max time.Duration) func(int) time.Duration {
+	return func(retry int) time.Duration {
+		d := base
+		for i := 1; i < retry && d < max; i++ {
+			d *= 2
+		}
+		if d > max {
+			d = max
+		}
+		return d
+	}
+}
+
+// CompletionPolicy waits until every dependency has completed: it aborts on
+// Aborted and PartialAbort, and retries (with exponential backoff, at most 5
+// times) on AbortRetry
+func CompletionPolicy() *Policy {
+	return &Policy{
+		Reactions: map[Signal]Reaction{
+			Completed:    Proceed,
+			Aborted:      Abort,
+			PartialAbort: Abort,
+			AbortRetry:   Retry,
+			Help:         HelpDependency,
+		},
+		MaxRetries: 5,
+		Delay:      ExponentialBackoff(10*time.Millisecond, time.Second),
+	}
+}
+
+// StartPolicy only waits until every dependency has started (or completed),
+// and aborts on Aborted and PartialAbort
+func StartPolicy() *Policy {
+	return &Policy{
+		Reactions: map[Signal]Reaction{
+			Started:      Proceed,
+			Completed:    Proceed,
+			Aborted:      Abort,
+			PartialAbort: Abort,
+		},
+	}
+}
+
+// BestEffortPolicy waits until every dependency has finished, whether it
+// completed or aborted
+func BestEffortPolicy() *Policy {
+	return &Policy{
+		Reactions: map[Signal]Reaction{
+			Completed:    Proceed,
+			Aborted:      Proceed,
+			PartialAbort: Proceed,
+		},
+	}
+}
+
+// AbortError is returned when a blocked node is aborted by the signal of a dependency
+type AbortError struct {
+	Node       int // the blocked node
+	Dependency int // the dependency whose signal aborted the node
+	Signal     NodeSignal
+}
+
+// Error ...
+func (e *AbortError) Error() string {
+	return fmt.Sprintf("Node %d aborted by signal %d from dependency %d", e.Node, e.Signal.Value, e.Dependency)
+}
+
+// BlockError is returned when a node stops blocking on its dependencies
+// because its context is done
+type BlockError struct {
+	Node        int   // the blocked node
+	Outstanding []int // the dependencies that had not released the node yet (sorted)
+	Err         error // the context's error
+}
+
+// Error ...
+func (e *BlockError) Error() string {
+	ids := make([]string, len(e.Outstanding))
+	for i, id := range e.Outstanding {
+		ids[i] = fmt.Sprint(id)
+	}
+
+	return fmt.Sprintf("Node %d stopped blocking (%v) while waiting on dependencies [%s]", e.Node, e.Err, strings.Join(ids, ", "))
+}
+
+// Unwrap returns the context's error
+func (e *BlockError) Unwrap() error {
+	return e.Err
+}
+
+// isFinal reports whether a signal is the last one a dependency sends
+func isFinal(s Signal) bool {
+	return s == Completed || s == Aborted || s == PartialAbort
+}
+
+// drain keeps receiving from a dependency until its final signal
+func drain(c <-chan NodeSignal) {
+	for sig := range c {
+		if isFinal(sig.Value) {
+			return
+		}
+	}
+}
+
+// Await blocks a node until the handler lets it proceed past every one of
+// its dependencies (the node's SignalsMap), or until a dependency aborts it,
+// in which case an *AbortError is returned.
+// NOTE: Await does not know the node's graph, so it does not record the node's
+// state: a node with a recorded state should be set back to Waiting (see
+// SetState) before it awaits, or use Block instead
+func Await(n DGNode, h SignalHandler) error {
+	return AwaitContext(context.Background(), n, h)
+}
+
+// AwaitContext is Await with a context: if the context is done before the node
+// may proceed, a *BlockError is returned and the node signals Aborted to its
+// own dependents
+func AwaitContext(ctx context.Context, n DGNode, h SignalHandler) error {
+	return awaitContext(ctx, n, h, nil, nil)
+}
+
+// awaitContext is AwaitContext with an (optional) Watchdog tracking the node
+func awaitContext(ctx context.Context, n DGNode, h SignalHandler, w *Watchdog, src nodeSource) error {
+	err := await(ctx, n, h, w, src)
+	if _, ok := err.(*BlockError); ok {
+		go n.Signal(nodeSignal(n, Aborted))
+	}
+
+	return err
+}
+
+// await blocks like AwaitContext, but leaves signaling dependents to the caller
+func await(ctx context.Context, n DGNode, h SignalHandler, w *Watchdog, src nodeSource) error {
+	signals := n.ListSignals()
+	if len(signals) == 0 {
+		return nil
+	}
+
+	deps := make([]int, 0, len(signals))
+	for id := range signals {
+		deps = append(deps, id)
+	}
+	w.begin(n, src, deps)
+	defer w.end(n.ID())
+
+	// once the node stops waiting (e.g. a dependency aborted it), so do the
+	// goroutines still waiting on its other dependencies
+	wctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	aborted := make(chan *AbortError, len(signals))
+	var mu sync.Mutex
+	outstanding := make(map[int]bool, len(signals))
+	for id := range signals {
+		outstanding[id] = true
+	}
+	var wg sync.WaitGroup
+
+	for id, c := range signals {
+		wg.Add(1)
+		go func(id int, c <-chan NodeSignal) {
+			defer wg.Done()
+
+			// released is deferred for every exit but a done context,
+			// after which the dependency is still outstanding
+			released := true
+			defer func() {
+				if released {
+					mu.Lock()
+					delete(outstanding, id)
+					mu.Unlock()
+					w.release(n.ID(), id)
+				}
+			}()
+
+			retries := 0
+			for {
+				if wctx.Err() != nil {
+					// checked first, as select picks a ready case at random
+					released = false
+					go drain(c)
+					return
+				}
+
+				var sig NodeSignal
+				var ok bool
+				select {
+				case sig, ok = <-c:
+				case <-wctx.Done():
+					// stop waiting, but do not leave the dependency blocked
+					released = false
+					go drain(c)
+					return
+				}
+				if !ok {
+					return
+				}
+
+				switch h.React(id, sig, retries) {
+				case Proceed:
+					if !isFinal(sig.Value) {
+						go drain(c)
+					}
+					return
+				case Abort:
+					aborted <- &AbortError{Node: n.ID(), Dependency: id, Signal: sig}
+					if !isFinal(sig.Value) {
+						go drain(c)
+					}
+					return
+				case Retry:
+					retries++
+					select {
+					case <-time.After(h.Backoff(retries)):
+					case <-wctx.Done():
+					}
+				case HelpDependency:
+					h.Help(id, sig)
+				}
+
+				if isFinal(sig.Value) {
+					// the dependency will not send anything else
+					return
+				}
+			}
+		}(id, c)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case err := <-aborted:
+		return err
+	case <-done:
+		// an abort may have raced with the last dependency finishing
+		select {
+		case err := <-aborted:
+			return err
+		default:
+		}
+		if ctx.Err() == nil {
+			return nil
+		}
+	case <-ctx.Done():
+	}
+
+	// the context is done: report the dependencies that have not released the node
+	mu.Lock()
+	defer mu.Unlock()
+	ids := make([]int, 0, len(outstanding))
+	for id := range outstanding {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+
+	return &BlockError{Node: n.ID(), Outstanding: ids, Err: ctx.Err()}
+}
+
+// Block blocks the node with the given id until the handler lets it proceed
+// past every one of its dependencies, or until a dependency aborts it
+// (in which case an *AbortError is returned, once the node has signaled
+// Aborted to its own dependents)
+func (g *Graph) Block(nodeID int, h SignalHandler) error {
+	return g.BlockContext(context.Background(), nodeID, h)
+}
+
+// BlockContext is Block with a context: if the context is done before the node
+// may proceed, a *BlockError is returned and the node signals Aborted to its
+// own dependents
+func (g *Graph) BlockContext(ctx context.Context, nodeID int, h SignalHandler) error {
+	n, ok := g.Node(nodeID)
+	if !ok {
+		return fmt.Errorf("Node %d does not exist in Dependency Graph.", nodeID)
+	}
+
+	return g.block(n, func() error { return await(ctx, n, h, g.watcher(), g) })
+}
+
+// Block blocks the virtual node with the given id until the handler lets it
+// proceed past every one of its dependencies, or until a dependency aborts it
+// (in which case an *AbortError is returned, once the node has signaled
+// Aborted to its own dependents)
+func (g *VDG) Block(nodeID int, h SignalHandler) error {
+	return g.BlockContext(context.Background(), nodeID, h)
+}
+
+// BlockContext is Block with a context: if the context is done before the node
+// may proceed, a *BlockError is returned and the node signals Aborted to its
+// own dependents
+func (g *VDG) BlockContext(ctx context.Context, nodeID int, h SignalHandler) error {
+	n, ok := g.Node(nodeID)
+	if !ok {
+		return fmt.Errorf("Node %d does not exist in Dependency Graph.", nodeID)
+	}
+
+	return g.block(n, func() error { return await(ctx, n, h, g.watcher(), g) })
+}
+
+// block records the state of a node while it blocks on its dependencies; a
+// node that may not proceed signals Aborted to its own dependents, before
+// returning if a dependency aborted it, or from a new goroutine if its
+// context is done (see AwaitContext)
+func (g *Graph) block(n DGNode, wait func() error) error {
+	g.recordState(n.ID(), Waiting)
+	err := wait()
+	switch err.(type) {
+	case nil:
+		g.recordState(n.ID(), Started)
+	case *AbortError:
+		g.finish(n, Aborted)
+	case *BlockError:
+		go g.finish(n, Aborted)
+	}
+
+	return err
+}
+
+// block records the state of a virtual node while it blocks on its
+// dependencies (see Graph.block)
+func (g *VDG) block(n DGNode, wait func() error) error {
+	g.recordState(n.ID(), Waiting)
+	err := wait()
+	switch err.(type) {
+	case nil:
+		g.recordState(n.ID(), Started)
+	case *AbortError:
+		g.finish(n, Aborted)
+	case *BlockError:
+		go g.finish(n, Aborted)
+	}
+
+	return err
+}
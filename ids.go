@@ -0,0 +1,194 @@
+package fabric
+
+import (
+	"fmt"
+	"math/rand"
+	"strconv"
+	"sync"
+)
+
+/*
+	ID Allocation
+
+	Graph.NextID and VDG.NextID (and GenID, for allocators that cannot run
+	out of ids) draw ids from an IDAllocator. By default every
+	graph in the process shares the same allocator (a counter starting at 1,
+	as id 0 is used by EmptyUI and Root), so ids are unique across all
+	graphs. A graph can be given its own allocator with
+	NewGraphWithAllocator (a VDG uses the allocator of its global graph
+	unless created with NewVDGWithAllocator), and tests can make ids
+	replayable with SetDefaultIDAllocator.
+
+	Allocators are also useful for implementing the CDS GenNodeID and
+	GenEdgeID methods. Allocators that remember the ids they issued (e.g.
+	RandomAllocator) implement IDReleaser, and should be given back the ids
+	that are no longer in use: Graph and VDG release the ids of the nodes
+	they remove.
+
+	NOTE: GenID still skips any id that is already in use in the graph
+	(e.g. ids assigned by hand), so an allocator does not need to know
+	which ids a graph holds.
+*/
+
+// IDAllocator hands out integer ids; implementations must be safe for concurrent use
+type IDAllocator interface {
+	Next() (int, error) // fails when the allocator has run out of ids
+}
+
+// Counter is a monotonic IDAllocator
+type Counter struct {
+	mu   sync.Mutex
+	next int
+}
+
+// NewCounter returns a Counter whose first id is start
+func NewCounter(start int) *Counter {
+	return &Counter{next: start}
+}
+
+// Next never fails
+func (c *Counter) Next() (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	id := c.next
+	c.next++
+	return id, nil
+}
+
+// IDReleaser is implemented by allocators that keep track of the ids they
+// issued; a released id may be handed out again
+type IDReleaser interface {
+	Release(id int)
+}
+
+// RandomAllocator hands out non-negative random ids from a seeded source,
+// never returning an id that is still issued (see Release); equal seeds
+// produce equal sequences
+type RandomAllocator struct {
+	mu     sync.Mutex
+	r      *rand.Rand
+	issued map[int]struct{}
+}
+
+// NewRandomAllocator ...
+func NewRandomAllocator(seed int64) *RandomAllocator {
+	return &RandomAllocator{
+		r:      rand.New(rand.NewSource(seed)),
+		issued: make(map[int]struct{}),
+	}
+}
+
+// Next never fails
+func (a *RandomAllocator) Next() (int, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	for {
+		id := a.r.Int()
+		if _, ok := a.issued[id]; !ok {
+			a.issued[id] = struct{}{}
+			return id, nil
+		}
+	}
+}
+
+// Release forgets an issued id, so that the allocator does not grow without
+// limit; the id may be handed out again
+func (a *RandomAllocator) Release(id int) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	delete(a.issued, id)
+}
+
+// NamespaceBits is the number of low bits of a namespaced id that hold its sequence number
+const NamespaceBits = 32
+
+// Namespace is an IDAllocator whose ids carry a namespace in their high bits
+// (namespace<<NamespaceBits | sequence, with sequences starting at 1), so
+// that allocators with different namespaces (e.g. one per graph) never
+// hand out the same id.
+type Namespace struct {
+	ns  int
+	seq *Counter
+}
+
+// NewNamespace returns an error if the namespaced ids do not fit in an int
+// (namespaces need 64-bit ints, and must be in [0, 2^31))
+func NewNamespace(namespace int) (*Namespace, error) {
+	if strconv.IntSize < 64 {
+		return nil, fmt.Errorf("Namespaced ids need 64-bit ints (ints have %d bits).", strconv.IntSize)
+	}
+	if namespace < 0 || int64(namespace) >= 1<<(63-NamespaceBits) {
+		return nil, fmt.Errorf("Namespace %d does not fit in %d bits.", namespace, 63-NamespaceBits)
+	}
+
+	return &Namespace{
+		ns:  namespace,
+		seq: NewCounter(1),
+	}, nil
+}
+
+// Next fails once every sequence number of the namespace has been handed out
+func (n *Namespace) Next() (int, error) {
+	seq, _ := n.seq.Next()
+	if int64(seq) >= 1<<NamespaceBits {
+		return 0, fmt.Errorf("Namespace %d is exhausted.", n.ns)
+	}
+	return int(int64(n.ns)<<NamespaceBits | int64(seq)), nil
+}
+
+// NamespaceOf returns the namespace of an id created by a Namespace
+func NamespaceOf(id int) int {
+	return int(int64(id) >> NamespaceBits)
+}
+
+var (
+	defaultIDsMu sync.RWMutex
+	defaultIDs   IDAllocator = NewCounter(1)
+)
+
+// SetDefaultIDAllocator replaces the allocator shared by graphs that were not
+// given their own (e.g. to make ids replayable in tests)
+func SetDefaultIDAllocator(a IDAllocator) {
+	defaultIDsMu.Lock()
+	defer defaultIDsMu.Unlock()
+
+	defaultIDs = a
+}
+
+// DefaultIDAllocator returns the allocator shared by graphs that were not given their own
+func DefaultIDAllocator() IDAllocator {
+	defaultIDsMu.RLock()
+	defer defaultIDsMu.RUnlock()
+
+	return defaultIDs
+}
+
+// nextID returns the next id of an allocator that is not in use
+func nextID(a IDAllocator, used func(int) bool) (int, error) {
+	if a == nil {
+		a = DefaultIDAllocator()
+	}
+	for {
+		id, err := a.Next()
+		if err != nil {
+			return 0, err
+		}
+		if !used(id) {
+			return id, nil
+		}
+	}
+}
+
+// releaseID gives an id that is no longer in use back to an allocator that
+// keeps track of the ids it issued (see IDReleaser)
+func releaseID(a IDAllocator, id int) {
+	if a == nil {
+		a = DefaultIDAllocator()
+	}
+	if r, ok := a.(IDReleaser); ok {
+		r.Release(id)
+	}
+}
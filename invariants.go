@@ -0,0 +1,102 @@
+package fabric
+
+/*
+	Invariant Sets
+
+	An access procedure usually only changes part of the Section it
+	operates on: an update of a single CDS node leaves every other node and
+	edge of the section invariant. An access type declares what it leaves
+	invariant by implementing Invariant; InvariantSets and WriteSets split a
+	section into the nodes/edges a procedure leaves invariant and the ones
+	it may write.
+
+	Access types that do not implement Invariant leave everything invariant
+	if they are of ReadClass, and nothing otherwise.
+
+	Two nodes only have to be ordered (see Conflicts) if an access procedure
+	of one may write a CDS node or edge that the other accesses (its whole
+	section); procedures whose write sets are disjoint from each other's
+	sections run without ordering edges, even if their classes conflict.
+*/
+
+// Invariant is implemented by access types that declare which CDS nodes and
+// edges they leave invariant
+type Invariant interface {
+	InvariantNode(Node) bool // whether the procedure leaves a CDS node invariant
+	InvariantEdge(Edge) bool // whether the procedure leaves a CDS edge invariant
+}
+
+func invariantNode(at AccessType, n Node) bool {
+	if i, ok := at.(Invariant); ok {
+		return i.InvariantNode(n)
+	}
+	return ClassOf(at) == ReadClass
+}
+
+func invariantEdge(at AccessType, e Edge) bool {
+	if i, ok := at.(Invariant); ok {
+		return i.InvariantEdge(e)
+	}
+	return ClassOf(at) == ReadClass
+}
+
+// InvariantSets returns the nodes and edges of a section that an access
+// procedure leaves invariant
+func InvariantSets(at AccessType, s Section) (NodeList, EdgeList) {
+	return splitSection(at, s, true)
+}
+
+// WriteSets returns the nodes and edges of a section that an access
+// procedure may write (i.e. does not leave invariant)
+func WriteSets(at AccessType, s Section) (NodeList, EdgeList) {
+	return splitSection(at, s, false)
+}
+
+func splitSection(at AccessType, s Section, invariant bool) (NodeList, EdgeList) {
+	nodes := make(NodeList, 0)
+	edges := make(EdgeList, 0)
+	if s == nil {
+		return nodes, edges
+	}
+	if l := s.ListNodes(); l != nil {
+		for _, n := range *l {
+			if invariantNode(at, n) == invariant {
+				nodes = append(nodes, n)
+			}
+		}
+	}
+	if l := s.ListEdges(); l != nil {
+		for _, e := range *l {
+			if invariantEdge(at, e) == invariant {
+				edges = append(edges, e)
+			}
+		}
+	}
+
+	return nodes, edges
+}
+
+// sectionOf returns the section a node accesses (nil if it cannot be determined)
+func sectionOf(n DGNode) Section {
+	if space := spaceOf(n); space != nil {
+		return space.GetSection()
+	}
+	return nil
+}
+
+// writes reports whether an access procedure may write any CDS node or edge
+// of the given id sets
+func writes(at AccessType, s Section, nodes, edges map[int]struct{}) bool {
+	w, we := WriteSets(at, s)
+	for _, n := range w {
+		if _, ok := nodes[n.ID()]; ok {
+			return true
+		}
+	}
+	for _, e := range we {
+		if _, ok := edges[e.ID()]; ok {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,233 @@
+package fabric
+
+import (
+	"fmt"
+	"sort"
+)
+
+/*
+	Multiple CDSs
+
+	A Graph can coordinate several CDSs at once (e.g. one per REST resource
+	of a server): every CDS is registered under a name with RegisterCDS, and
+	every UI declares which CDS its Section belongs to by implementing
+	NamedUI. UIs that do not implement NamedUI (or return DefaultCDS) belong
+	to the graph's default CDS, Graph.DS.
+
+	Coverage and totality-uniqueness are properties of a single CDS: a UI
+	only covers the CDS its Section belongs to, and two UIs over different
+	CDSs never overlap (CDS node and edge ids are only unique within a CDS).
+	CoveredCDS and TotalityUniqueCDS check one CDS; Covered and
+	TotalityUnique check every CDS of the graph.
+
+	Dependencies between UIs of different CDSs are ordinary edges
+	(AddRealEdge): a request that touches two resources is a node that
+	depends on (or is depended on by) UIs of both CDSs.
+*/
+
+// DefaultCDS is the name of a graph's default CDS (Graph.DS)
+const DefaultCDS = ""
+
+// NamedUI is a UI whose Section belongs to a named CDS (see RegisterCDS)
+type NamedUI interface {
+	UI
+	CDSName() string
+}
+
+// CDSOf returns the name of the CDS a UI's Section belongs to
+func CDSOf(u UI) string {
+	if n, ok := u.(NamedUI); ok {
+		return n.CDSName()
+	}
+	return DefaultCDS
+}
+
+// RegisterCDS adds a named CDS to the graph
+// (the default CDS is set with Graph.DS)
+func (g *Graph) RegisterCDS(name string, c CDS) error {
+	if name == DefaultCDS {
+		return fmt.Errorf("The default CDS cannot be registered. Set Graph.DS instead.")
+	}
+	if c == nil {
+		return fmt.Errorf("CDS %q is nil.", name)
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if _, ok := g.cdss[name]; ok {
+		return fmt.Errorf("CDS %q is already registered.", name)
+	}
+	if g.cdss == nil {
+		g.cdss = make(map[string]CDS)
+	}
+	g.cdss[name] = c
+
+	return nil
+}
+
+// UnregisterCDS removes a named CDS from the graph
+func (g *Graph) UnregisterCDS(name string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	delete(g.cdss, name)
+}
+
+// CDS returns the CDS registered under a name (DefaultCDS returns Graph.DS)
+func (g *Graph) CDS(name string) (CDS, bool) {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	return g.cds(name)
+}
+
+func (g *Graph) cds(name string) (CDS, bool) {
+	if name == DefaultCDS {
+		return g.DS, g.DS != nil
+	}
+	c, ok := g.cdss[name]
+	return c, ok
+}
+
+// CDSNames returns the names of every CDS of the graph (sorted); the
+// default CDS is included if Graph.DS is set
+func (g *Graph) CDSNames() []string {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	return g.cdsNames()
+}
+
+func (g *Graph) cdsNames() []string {
+	var names []string
+	if g.DS != nil {
+		names = append(names, DefaultCDS)
+	}
+	for name := range g.cdss {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// uis returns the UI nodes of the graph whose Section belongs to the named CDS
+// (sorted by id)
+func (g *Graph) uis(name string) []UI {
+	var list []UI
+	for _, id := range g.adj.ids() {
+		n := g.nodes[id]
+		if n.GetType() != UINode {
+			continue
+		}
+		if u, ok := n.(UI); ok && CDSOf(u) == name {
+			list = append(list, u)
+		}
+	}
+
+	return list
+}
+
+// CoveredCDS returns true if all nodes and edges of the named CDS are covered
+// by the UIs of that CDS (see Coverage)
+func (g *Graph) CoveredCDS(name string) bool {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	return g.covered(name)
+}
+
+func (g *Graph) covered(name string) bool {
+	r, err := g.coverage(name)
+	return err == nil && r.Covered()
+}
+
+// TotalityUniqueCDS is a Totality-Uniqueness check for the UI nodes of the named CDS
+// (see VerifyUniqueness)
+func (g *Graph) TotalityUniqueCDS(name string) bool {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	return g.totalityUnique(name)
+}
+
+func (g *Graph) totalityUnique(name string) bool {
+	return !hasViolation(g.uniquenessConflicts(func(n string) bool { return n == name }), TotalityViolation)
+}
+
+// AddTotalUI adds a UI that covers the entire named CDS to the graph
+func (g *Graph) AddTotalUI(name string) (UI, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	c, ok := g.cds(name)
+	if !ok {
+		return nil, fmt.Errorf("CDS %q is not registered.", name)
+	}
+
+	id, err := g.nextNodeID()
+	if err != nil {
+		return nil, err
+	}
+	ui := NewCDSUI(id, name, totalSection(c))
+	if _, err := g.addNode(ui); err != nil {
+		return nil, err
+	}
+
+	return ui, nil
+}
+
+// SingleUIGraphs creates a graph with a single UI for each of the given CDSs
+// (one of which may be the default CDS)
+func SingleUIGraphs(cdss map[string]CDS) (*Graph, error) {
+	graph := NewGraph()
+	for name, c := range cdss {
+		if name == DefaultCDS {
+			graph.DS = c
+		} else if err := graph.RegisterCDS(name, c); err != nil {
+			return graph, err
+		}
+	}
+
+	for _, name := range graph.CDSNames() {
+		if _, err := graph.AddTotalUI(name); err != nil {
+			return graph, err
+		}
+	}
+
+	return graph, nil
+}
+
+func totalSection(c CDS) Section {
+	nodes := c.ListNodes()
+	edges := c.ListEdges()
+
+	return NewDisjoint(&nodes, &edges)
+}
+
+// CDSUI is a UI over a Section of a named CDS
+type CDSUI struct {
+	*EmptyUI
+	Id   int
+	Name string
+}
+
+// NewCDSUI ...
+func NewCDSUI(id int, name string, section Section) *CDSUI {
+	return &CDSUI{
+		EmptyUI: NewTotalUI(section).(*EmptyUI),
+		Id:      id,
+		Name:    name,
+	}
+}
+
+// ID ...
+func (u *CDSUI) ID() int {
+	return u.Id
+}
+
+// CDSName ...
+func (u *CDSUI) CDSName() string {
+	return u.Name
+}
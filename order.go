@@ -0,0 +1,89 @@
+package fabric
+
+/*
+	Topological Ordering
+
+	A dependency graph is a partial order: a node may only run after every
+	one of its dependencies. TopologicalOrder returns one total order that
+	respects the partial order, and Levels groups nodes into antichains
+	(nodes with no ordering between them) that can run in parallel, e.g. to
+	plan thread assignment for UIs and temporal nodes, or to display the
+	schedule that a Poset's Order() method produced.
+
+	Both orders are deterministic for equal inputs: nodes in the same level
+	are sorted by ID. If the graph contains a cycle a *CycleError is returned.
+*/
+
+// TopologicalOrder returns all nodes in the graph ordered so that every
+// node comes after all of its dependencies
+func (g *Graph) TopologicalOrder() ([]DGNode, error) {
+	levels, err := g.Levels()
+	if err != nil {
+		return nil, err
+	}
+
+	var list []DGNode
+	for _, l := range levels {
+		list = append(list, l...)
+	}
+
+	return list, nil
+}
+
+// Levels returns the nodes of the graph as a list of antichains; all nodes in
+// a level can run in parallel once every node in the previous levels has completed
+func (g *Graph) Levels() ([][]DGNode, error) {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	ids, ok := g.adj.levels()
+	if !ok {
+		return nil, &CycleError{Path: g.adj.findCycle()}
+	}
+
+	levels := make([][]DGNode, len(ids))
+	for i, l := range ids {
+		for _, id := range l {
+			levels[i] = append(levels[i], g.nodes[id])
+		}
+	}
+
+	return levels, nil
+}
+
+// TopologicalOrder returns all nodes in the VDG ordered so that every
+// node comes after all of its dependencies
+func (g *VDG) TopologicalOrder() ([]Virtual, error) {
+	levels, err := g.Levels()
+	if err != nil {
+		return nil, err
+	}
+
+	var list []Virtual
+	for _, l := range levels {
+		list = append(list, l...)
+	}
+
+	return list, nil
+}
+
+// Levels returns the nodes of the VDG as a list of antichains; all nodes in
+// a level can run in parallel once every node in the previous levels has completed
+func (g *VDG) Levels() ([][]Virtual, error) {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	ids, ok := g.adj.levels()
+	if !ok {
+		return nil, &CycleError{Path: g.adj.findCycle()}
+	}
+
+	levels := make([][]Virtual, len(ids))
+	for i, l := range ids {
+		for _, id := range l {
+			levels[i] = append(levels[i], g.nodes[id])
+		}
+	}
+
+	return levels, nil
+}
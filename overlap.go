@@ -0,0 +1,192 @@
+package fabric
+
+import "sort"
+
+/*
+	Section Overlaps
+
+	Two UIs (or VUIs) whose Sections share CDS nodes or edges must never
+	operate at the same time: one of them has to depend (transitively) on
+	the other. Finding every such pair by hand is error-prone, so a Graph
+	can compute them:
+
+		Overlaps      - every pair of UI/VUI nodes of the same CDS whose
+		                Sections share nodes or edges, and whether the pair
+		                is already ordered by the graph
+		OrderOverlaps - adds an edge for every unordered pair whose access
+		                procedures conflict (see Conflicts); a TieBreak
+		                decides which node of a pair goes first (e.g.
+		                ByPriority)
+
+	An edge is only added between nodes that are not ordered yet, so
+	OrderOverlaps never creates a cycle.
+*/
+
+// SectionOverlap is a pair of UI/VUI nodes whose Sections share CDS nodes or edges
+type SectionOverlap struct {
+	A, B    int   // node ids (A < B)
+	Nodes   []int // ids of the shared CDS nodes (sorted)
+	Edges   []int // ids of the shared CDS edges (sorted)
+	Ordered bool  // whether one of the nodes (transitively) depends on the other
+}
+
+// TieBreak reports whether UI a should operate before UI b
+type TieBreak func(a, b UI) bool
+
+// ByPriority lets the UI with the larger priority go first
+// (the UI with the smaller id on equal priorities)
+func ByPriority(a, b UI) bool {
+	if a.GetPriority() != b.GetPriority() {
+		return a.GetPriority() > b.GetPriority()
+	}
+	return a.ID() < b.ID()
+}
+
+// sectionIDs returns the ids of the CDS nodes and edges of a section
+func sectionIDs(s Section) (map[int]struct{}, map[int]struct{}) {
+	nodes := make(map[int]struct{})
+	edges := make(map[int]struct{})
+	if s == nil {
+		return nodes, edges
+	}
+	if l := s.ListNodes(); l != nil {
+		for _, n := range *l {
+			nodes[n.ID()] = struct{}{}
+		}
+	}
+	if l := s.ListEdges(); l != nil {
+		for _, e := range *l {
+			edges[e.ID()] = struct{}{}
+		}
+	}
+
+	return nodes, edges
+}
+
+// intersect returns the ids in both sets (sorted)
+func intersect(a, b map[int]struct{}) []int {
+	var list []int
+	for id := range a {
+		if _, ok := b[id]; ok {
+			list = append(list, id)
+		}
+	}
+	sort.Ints(list)
+
+	return list
+}
+
+// reaches reports whether `from` (transitively) depends on `to`
+func (a adjacency) reaches(from, to int) bool {
+	seen := map[int]bool{from: true}
+	stack := []int{from}
+	for len(stack) > 0 {
+		id := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		for d := range a.out[id] {
+			if d == to {
+				return true
+			}
+			if !seen[d] {
+				seen[d] = true
+				stack = append(stack, d)
+			}
+		}
+	}
+
+	return false
+}
+
+// spaces returns the UI and VUI nodes of the graph (sorted by id)
+func (g *Graph) spaces() []UI {
+	var list []UI
+	for _, id := range g.adj.ids() {
+		n := g.nodes[id]
+		if t := n.GetType(); t != UINode && t != VUINode {
+			continue
+		}
+		if u, ok := n.(UI); ok {
+			list = append(list, u)
+		}
+	}
+
+	return list
+}
+
+// overlaps returns every overlapping pair of UI/VUI nodes (sorted by A, then B)
+func (g *Graph) overlaps() []SectionOverlap {
+	uis := g.spaces()
+	nodes := make([]map[int]struct{}, len(uis))
+	edges := make([]map[int]struct{}, len(uis))
+	for i, u := range uis {
+		nodes[i], edges[i] = sectionIDs(u.GetSection())
+	}
+
+	var list []SectionOverlap
+	for i, a := range uis {
+		for j := i + 1; j < len(uis); j++ {
+			b := uis[j]
+			if CDSOf(a) != CDSOf(b) {
+				continue
+			}
+			o := SectionOverlap{
+				A:     a.ID(),
+				B:     b.ID(),
+				Nodes: intersect(nodes[i], nodes[j]),
+				Edges: intersect(edges[i], edges[j]),
+			}
+			if len(o.Nodes) == 0 && len(o.Edges) == 0 {
+				continue
+			}
+			o.Ordered = g.adj.reaches(o.A, o.B) || g.adj.reaches(o.B, o.A)
+			list = append(list, o)
+		}
+	}
+
+	return list
+}
+
+// Overlaps returns every pair of UI/VUI nodes of the same CDS whose Sections
+// share CDS nodes or edges (sorted by A, then B)
+func (g *Graph) Overlaps() []SectionOverlap {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	return g.overlaps()
+}
+
+// OrderOverlaps adds an edge between every pair of overlapping UI/VUI nodes
+// that is not ordered yet and whose access procedures conflict: the node the
+// TieBreak lets go first becomes a dependency of the other one. Returns the
+// pairs that were ordered.
+func (g *Graph) OrderOverlaps(first TieBreak) ([]SectionOverlap, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.init()
+
+	compat := g.compatibility()
+	var ordered []SectionOverlap
+	for _, o := range g.overlaps() {
+		// an earlier edge may have ordered the pair already
+		if o.Ordered || g.adj.reaches(o.A, o.B) || g.adj.reaches(o.B, o.A) {
+			continue
+		}
+
+		a, b := g.nodes[o.A], g.nodes[o.B]
+		if !compat.conflicts(a, b) {
+			continue
+		}
+		if first(a.(UI), b.(UI)) {
+			a, b = b, a
+		}
+		// a operates after b
+		if err := g.addEdge(a, b); err != nil {
+			return ordered, err
+		}
+		o.Ordered = true
+		ordered = append(ordered, o)
+	}
+
+	return ordered, nil
+}
@@ -26,6 +26,9 @@ type VPoset interface {
 	Order(Virtual) error
 }
 
+// NOTE: the schedule that Order() produced can be inspected with the
+//		Levels() and TopologicalOrder() methods of the wrapped Graph or VDG.
+
 // EXAMPLE: Access Type Priority Ordering
 //		if a DGNode has an Access type with priority lower than
 //		all other Access Types in another DGNode, then it automatically
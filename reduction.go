@@ -0,0 +1,179 @@
+package fabric
+
+/*
+	Transitive Reduction
+
+	A Poset that orders every new node after every node before it (e.g. by
+	priority) creates an edge, and a signaling channel, between every pair
+	of nodes: O(n^2) edges for a chain of n nodes. Most of those edges are
+	redundant: if a depends on b and b depends on c, then an edge from a to
+	c does not change the partial order, since a already (transitively)
+	waits on c.
+
+	TransitiveReduction removes every redundant edge (and retires its
+	signaling channel), leaving the same partial order with the fewest
+	edges. Reduced and ReducedV wrap a Poset or VPoset so that the reduction
+	is applied after every Order() call.
+
+	NOTE: an edge whose dependency is currently executing (i.e. it may be
+	sending signals on the edge's channel), or whose dependent is blocked on
+	its dependencies (i.e. it may be receiving on the channel, and would be
+	released by retiring it), is never removed; such edges are removed by a
+	later reduction once both nodes have moved on. The Executor (and Block)
+	only record a node's final state once its final signal has been sent;
+	nodes that drive their own signaling should do the same (see SetState).
+*/
+
+// redundant returns the edges `from -> to` of an acyclic index that are
+// implied by another path from `from` to `to` (sorted by from, then to);
+// returns false if the index has a cycle
+func (a adjacency) redundant() ([][2]int, bool) {
+	levels, ok := a.levels()
+	if !ok {
+		return nil, false
+	}
+
+	// reach[id] holds every node id (transitively) depends on; levels are in
+	// dependency order, so the dependencies of a node are always done first
+	reach := make(map[int]map[int]struct{}, len(a.out))
+	for _, l := range levels {
+		for _, id := range l {
+			r := make(map[int]struct{})
+			for d := range a.out[id] {
+				r[d] = struct{}{}
+				for t := range reach[d] {
+					r[t] = struct{}{}
+				}
+			}
+			reach[id] = r
+		}
+	}
+
+	var edges [][2]int
+	for _, from := range a.ids() {
+		for _, to := range sortedSet(a.out[from]) {
+			for d := range a.out[from] {
+				if _, ok := reach[d][to]; ok && d != to {
+					edges = append(edges, [2]int{from, to})
+					break
+				}
+			}
+		}
+	}
+
+	return edges, true
+}
+
+// isActive reports whether a node with the given state may still be sending signals
+func isActive(s Signal) bool {
+	return s == Started || s == AbortRetry || s == Help
+}
+
+// TransitiveReduction removes every edge (and signaling channel) of the graph that
+// is implied by other edges, and returns the number of edges removed.
+// Fails with a *CycleError if the graph has a cycle.
+func (g *Graph) TransitiveReduction() (int, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	edges, ok := g.adj.redundant()
+	if !ok {
+		return 0, &CycleError{Path: g.adj.findCycle()}
+	}
+
+	removed := 0
+	for _, e := range edges {
+		if isActive(g.states[e[1]]) || g.sending[e[1]] > 0 || g.blocked(e[0]) {
+			continue
+		}
+		g.removeEdge(g.nodes[e[0]], g.nodes[e[1]])
+		removed++
+	}
+
+	return removed, nil
+}
+
+// TransitiveReduction removes every edge (and signaling channel) of the VDG that
+// is implied by other edges, and returns the number of edges removed.
+// Fails with a *CycleError if the VDG has a cycle.
+func (g *VDG) TransitiveReduction() (int, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	edges, ok := g.adj.redundant()
+	if !ok {
+		return 0, &CycleError{Path: g.adj.findCycle()}
+	}
+
+	removed := 0
+	for _, e := range edges {
+		dest := g.nodes[e[1]]
+		state, ok := g.states[dest.ID()]
+		sending := isActive(state) || g.sending[dest.ID()] > 0 || (dest.Started() && !(ok && isFinal(state)))
+		if sending || g.blocked(e[0]) {
+			continue
+		}
+		g.removeEdge(g.nodes[e[0]], dest)
+		removed++
+	}
+
+	return removed, nil
+}
+
+// reducedPoset applies a transitive reduction to the graph after every Order()
+type reducedPoset struct {
+	Poset
+}
+
+// Reduced wraps a Poset so that redundant edges are removed from its graph
+// after every Order() call
+func Reduced(p Poset) Poset {
+	return &reducedPoset{p}
+}
+
+// InitGraph ...
+func (p *reducedPoset) InitGraph(nodes []DGNode) *Graph {
+	g := p.Poset.InitGraph(nodes)
+	g.TransitiveReduction()
+
+	return g
+}
+
+// Order ...
+func (p *reducedPoset) Order(n DGNode) error {
+	if err := p.Poset.Order(n); err != nil {
+		return err
+	}
+
+	_, err := p.Graph().TransitiveReduction()
+	return err
+}
+
+// reducedVPoset applies a transitive reduction to the VDG after every Order()
+type reducedVPoset struct {
+	VPoset
+}
+
+// ReducedV wraps a VPoset so that redundant edges are removed from its VDG
+// after every Order() call
+func ReducedV(p VPoset) VPoset {
+	return &reducedVPoset{p}
+}
+
+// InitGraph ...
+func (p *reducedVPoset) InitGraph(nodes []Virtual) *VDG {
+	v := p.VPoset.InitGraph(nodes)
+	v.TransitiveReduction()
+
+	return v
+}
+
+// Order ...
+func (p *reducedVPoset) Order(n Virtual) error {
+	if err := p.VPoset.Order(n); err != nil {
+		return err
+	}
+
+	_, err := p.VDG().TransitiveReduction()
+	return err
+}
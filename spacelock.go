@@ -0,0 +1,229 @@
+package fabric
+
+import (
+	"context"
+	"sync"
+)
+
+/*
+	Space Locks
+
+	By default a (V)UI behaves like one exclusive lock over its Section: the
+	nodes that operate on it are ordered by the edges of the graph. A
+	SpaceLock gives a finer-grained reader/writer mode instead: any number of
+	readers (nodes whose access procedures are all of ReadClass, see
+	AccessClass) may operate on the same (V)UI at the same time, while a
+	writer (any other node) waits for the readers in flight and keeps new
+	ones out until it is done.
+
+	The space of a node is the (V)UI it operates on: the Subspace of a
+	Virtual node, a UI itself, or the first root of a Temporal node. Nodes
+	without a space are not locked.
+
+	The Policy decides who goes first when readers and writers are waiting:
+
+		WriterPreference - (default) a waiting writer blocks new readers, so
+		                   writers are never starved
+		ReaderPreference - readers join the readers in flight, even when a
+		                   writer is waiting (maximum read throughput)
+		FIFO             - nodes acquire the space in arrival order; a run
+		                   of consecutive readers shares it
+
+	Set an Executor's Locks to lock the space of every node while its
+	function runs (after its dependencies have let it proceed).
+*/
+
+// RWPolicy decides the order in which waiting readers and writers acquire a space
+type RWPolicy int
+
+const (
+	// WriterPreference lets a waiting writer block new readers
+	WriterPreference RWPolicy = iota
+	// ReaderPreference lets new readers join the readers in flight even when a writer is waiting
+	ReaderPreference
+	// FIFO grants the space in arrival order
+	FIFO
+)
+
+// IsReader reports whether a node only reads its space
+// (it has access procedures, and all of them are of ReadClass)
+func IsReader(n DGNode) bool {
+	procedures := n.ListProcedures()
+	if len(procedures) == 0 {
+		return false
+	}
+	for _, p := range procedures {
+		if ClassOf(p) != ReadClass {
+			return false
+		}
+	}
+	return true
+}
+
+type spaceWaiter struct {
+	reader bool
+	ready  chan struct{} // closed once the space is granted
+}
+
+// spaceState is the lock state of a single space
+type spaceState struct {
+	readers int
+	writer  bool
+	queue   []*spaceWaiter
+}
+
+// SpaceLock is a reader/writer lock for every (V)UI of a system
+type SpaceLock struct {
+	Policy RWPolicy
+
+	mu     sync.Mutex
+	spaces map[int]*spaceState // (V)UI id -> state
+}
+
+// NewSpaceLock ...
+func NewSpaceLock(policy RWPolicy) *SpaceLock {
+	return &SpaceLock{
+		Policy: policy,
+		spaces: make(map[int]*spaceState),
+	}
+}
+
+// Lock blocks until the node may operate on its space (shared for a reader,
+// exclusive for a writer), and returns the function that releases it (only
+// its first call releases the space, so it may be deferred and called early).
+// If the context is done first, a *BlockError is returned.
+func (l *SpaceLock) Lock(ctx context.Context, n DGNode) (func(), error) {
+	space := spaceOf(n)
+	if space == nil {
+		return func() {}, nil
+	}
+	id := space.ID()
+	w := &spaceWaiter{reader: IsReader(n), ready: make(chan struct{})}
+
+	l.mu.Lock()
+	if l.spaces == nil {
+		l.spaces = make(map[int]*spaceState)
+	}
+	s, ok := l.spaces[id]
+	if !ok {
+		s = &spaceState{}
+		l.spaces[id] = s
+	}
+	s.queue = append(s.queue, w)
+	l.dispatch(s)
+	l.mu.Unlock()
+
+	var once sync.Once
+	release := func() { once.Do(func() { l.release(id, w.reader) }) }
+
+	select {
+	case <-w.ready:
+		return release, nil
+	case <-ctx.Done():
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	select {
+	case <-w.ready:
+		// granted while the context was done: give the space back
+		l.releaseLocked(id, w.reader)
+	default:
+		for i, q := range s.queue {
+			if q == w {
+				s.queue = append(s.queue[:i], s.queue[i+1:]...)
+				break
+			}
+		}
+		// a writer that gives up may let readers in
+		l.dispatch(s)
+		if s.readers == 0 && !s.writer && len(s.queue) == 0 {
+			delete(l.spaces, id)
+		}
+	}
+
+	return nil, &BlockError{Node: n.ID(), Outstanding: []int{id}, Err: ctx.Err()}
+}
+
+func (l *SpaceLock) release(space int, reader bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.releaseLocked(space, reader)
+}
+
+// releaseLocked must be called with the lock held
+func (l *SpaceLock) releaseLocked(space int, reader bool) {
+	s := l.spaces[space]
+	if reader {
+		s.readers--
+	} else {
+		s.writer = false
+	}
+	l.dispatch(s)
+	if s.readers == 0 && !s.writer && len(s.queue) == 0 {
+		delete(l.spaces, space)
+	}
+}
+
+// dispatch grants the space to the waiters the policy lets in; must be called
+// with the lock held
+func (l *SpaceLock) dispatch(s *spaceState) {
+	grant := func(i int) {
+		w := s.queue[i]
+		if w.reader {
+			s.readers++
+		} else {
+			s.writer = true
+		}
+		close(w.ready)
+		s.queue = append(s.queue[:i], s.queue[i+1:]...)
+	}
+
+	switch l.Policy {
+	case FIFO:
+		for len(s.queue) > 0 && !s.writer {
+			if !s.queue[0].reader && s.readers > 0 {
+				return
+			}
+			grant(0)
+		}
+	default:
+		writerWaiting := false
+		for _, w := range s.queue {
+			if !w.reader {
+				writerWaiting = true
+				break
+			}
+		}
+		// readers first, unless a writer is waiting and writers are preferred
+		if !s.writer && !(writerWaiting && l.Policy == WriterPreference) {
+			for i := 0; i < len(s.queue); {
+				if s.queue[i].reader {
+					grant(i)
+				} else {
+					i++
+				}
+			}
+		}
+		if !s.writer && s.readers == 0 {
+			for i, w := range s.queue {
+				if !w.reader {
+					grant(i)
+					return
+				}
+			}
+		}
+	}
+}
+
+// Holders returns the number of readers and whether a writer currently holds a space
+func (l *SpaceLock) Holders(space int) (int, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if s, ok := l.spaces[space]; ok {
+		return s.readers, s.writer
+	}
+	return 0, false
+}
@@ -0,0 +1,191 @@
+// +build test
+
+package fabric_test
+
+import (
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/JKhawaja/fabric"
+)
+
+// journal records the order in which access procedures were rolled back
+type journal struct {
+	mu  sync.Mutex
+	ids []int
+}
+
+// Procedure is a test AccessType that writes to a journal on rollback
+type Procedure struct {
+	Id      int
+	Node    int
+	Journal *journal
+}
+
+func (p Procedure) ID() int {
+	return p.Id
+}
+
+func (p Procedure) Priority() int {
+	return 1
+}
+
+func (p Procedure) Commit(n fabric.DGNode) error {
+	n.Signal(fabric.NodeSignal{AccessType: p.Id, Value: fabric.Completed})
+	return nil
+}
+
+func (p Procedure) Rollback(fabric.RestoreNodes, fabric.RestoreEdges) error {
+	p.Journal.mu.Lock()
+	defer p.Journal.mu.Unlock()
+	p.Journal.ids = append(p.Journal.ids, p.Node)
+	return nil
+}
+
+// TestAbortChain: an abort reaches every transitive dependent, except
+// for the ones that already completed
+func TestAbortChain(t *testing.T) {
+	graph := fabric.NewGraph()
+	j := &journal{}
+	nodes := make(map[int]UI)
+	for id := 1; id <= 5; id++ {
+		u := newTestUI(id, false)
+		*u.AccessProcedures = fabric.ProcedureList{Procedure{Id: 1, Node: id, Journal: j}}
+		nodes[id] = u
+		if _, err := graph.AddRealNode(u); err != nil {
+			t.Fatalf("Could not add UI node to graph: %v", err)
+		}
+	}
+	// 3 -> 2 -> 1, 4 -> 1; 5 is unrelated
+	graph.AddRealEdge(2, nodes[1])
+	graph.AddRealEdge(3, nodes[2])
+	graph.AddRealEdge(4, nodes[1])
+	graph.SetState(4, fabric.Completed)
+
+	report, err := graph.AbortChain(1, fabric.Aborted)
+	if err != nil {
+		t.Fatalf("Could not propagate abort: %v", err)
+	}
+	if !reflect.DeepEqual(report.Aborted, []int{1, 2, 3}) {
+		t.Fatalf("Unexpected aborted nodes: %v", report.Aborted)
+	}
+	if !reflect.DeepEqual(report.Completed, []int{4}) {
+		t.Fatalf("Unexpected completed nodes: %v", report.Completed)
+	}
+	// dependents are rolled back before their dependencies
+	if !reflect.DeepEqual(j.ids, []int{3, 2, 1}) {
+		t.Fatalf("Unexpected rollback order: %v", j.ids)
+	}
+	if s, _ := graph.State(3); s != fabric.Aborted {
+		t.Fatalf("Unexpected state for node 3: %v", s)
+	}
+	if s, _ := graph.State(5); s != fabric.Waiting {
+		t.Fatalf("Unrelated node was aborted: %v", s)
+	}
+
+	// aborted nodes are not rolled back twice
+	j.ids = nil
+	if _, err := graph.AbortChain(2, fabric.PartialAbort); err != nil {
+		t.Fatalf("Could not propagate abort: %v", err)
+	}
+	if len(j.ids) != 0 {
+		t.Fatalf("Nodes were rolled back twice: %v", j.ids)
+	}
+
+	if _, err := graph.AbortChain(1, fabric.Completed); err == nil {
+		t.Fatal("Propagated a signal that is not an abort")
+	}
+}
+
+// TestAbortChainSignals: the dependents that are blocked on an aborted node
+// receive the abort, and forward it to their own dependents
+func TestAbortChainSignals(t *testing.T) {
+	graph := fabric.NewGraph()
+	for id := 1; id <= 3; id++ {
+		if _, err := graph.AddRealNode(newTestUI(id, false)); err != nil {
+			t.Fatalf("Could not add UI node to graph: %v", err)
+		}
+	}
+	// 3 -> 2 -> 1
+	graph.AddRealEdge(2, newTestUI(1, false))
+	graph.AddRealEdge(3, newTestUI(2, false))
+	graph.SetState(1, fabric.Started)
+
+	errs := make(chan error, 2)
+	for _, id := range []int{2, 3} {
+		// any state but Waiting, so that Block recording Waiting can be seen
+		graph.SetState(id, fabric.Completed)
+		go func(id int) { errs <- graph.Block(id, fabric.CompletionPolicy()) }(id)
+	}
+	for _, id := range []int{2, 3} {
+		for s, _ := graph.State(id); s != fabric.Waiting; s, _ = graph.State(id) {
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	if _, err := graph.AbortChain(1, fabric.Aborted); err != nil {
+		t.Fatalf("Could not propagate abort: %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		select {
+		case err := <-errs:
+			if _, ok := err.(*fabric.AbortError); !ok {
+				t.Fatalf("Blocked dependent was not aborted: %v", err)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("Blocked dependent did not receive the abort")
+		}
+	}
+}
+
+// SectionProcedure is a test AccessType that keeps the section it is
+// given on rollback
+type SectionProcedure struct {
+	Restored *fabric.RestoreNodes
+}
+
+func (p SectionProcedure) ID() int {
+	return 1
+}
+
+func (p SectionProcedure) Priority() int {
+	return 1
+}
+
+func (p SectionProcedure) Commit(n fabric.DGNode) error {
+	return nil
+}
+
+func (p SectionProcedure) Rollback(nodes fabric.RestoreNodes, edges fabric.RestoreEdges) error {
+	*p.Restored = nodes
+	return nil
+}
+
+// TestAbortChainPreImage: Rollback receives the section as it was before the
+// node started operating on it
+func TestAbortChainPreImage(t *testing.T) {
+	graph := fabric.NewGraph()
+	u := newTestUI(1, false)
+	nodes := fabric.NodeList{ElementNode{Id: 1}}
+	u.CDS = &fabric.Subgraph{Nodes: &nodes, Edges: &fabric.EdgeList{}}
+	var restored fabric.RestoreNodes
+	*u.AccessProcedures = fabric.ProcedureList{SectionProcedure{Restored: &restored}}
+	if _, err := graph.AddRealNode(u); err != nil {
+		t.Fatalf("Could not add UI node to graph: %v", err)
+	}
+
+	graph.SetState(1, fabric.Started)
+	// the access procedure operates on the section
+	nodes[0] = ElementNode{Id: 2}
+	nodes = append(nodes, ElementNode{Id: 3})
+	u.CDS.UpdateNodeList(&nodes)
+
+	if _, err := graph.AbortChain(1, fabric.Aborted); err != nil {
+		t.Fatalf("Could not propagate abort: %v", err)
+	}
+	if len(restored) != 1 || restored[0].ID() != 1 {
+		t.Fatalf("Rollback was not given the pre-image: %v", restored)
+	}
+}
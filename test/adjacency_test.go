@@ -0,0 +1,183 @@
+// +build test
+
+package fabric_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/JKhawaja/fabric"
+)
+
+/*
+	Benchmarks comparing the ID-indexed adjacency of fabric.Graph against
+	the previous map-of-slices layout (reproduced below as legacyGraph).
+*/
+
+// legacyGraph is the map-of-slices layout that fabric.Graph used before
+// it kept an adjacency index; every lookup scans the whole map
+type legacyGraph map[fabric.DGNode][]fabric.DGNode
+
+func (l legacyGraph) dependents(n fabric.DGNode) []fabric.DGNode {
+	var list []fabric.DGNode
+	for i, v := range l {
+		if i.ID() != n.ID() && legacyContains(v, n) {
+			list = append(list, i)
+		}
+	}
+	return list
+}
+
+func (l legacyGraph) addEdge(source int, dest fabric.DGNode) {
+	for i, k := range l {
+		if i.ID() == source && !legacyContains(k, dest) {
+			l[i] = append(k, dest)
+		}
+	}
+}
+
+func (l legacyGraph) remove(n fabric.DGNode) {
+	for n1, k := range l {
+		for j, v := range k {
+			if v.ID() == n.ID() {
+				l[n1] = append(k[:j], k[j+1:]...)
+				break
+			}
+		}
+	}
+	delete(l, n)
+}
+
+func legacyContains(s []fabric.DGNode, n fabric.DGNode) bool {
+	for _, v := range s {
+		if v.ID() == n.ID() {
+			return true
+		}
+	}
+	return false
+}
+
+// star builds a graph where a single UI (id 0) depends on n VUIs
+func star(n int) (*fabric.Graph, legacyGraph, UI, []UI) {
+	graph := fabric.NewGraph()
+	legacy := make(legacyGraph)
+
+	root := newTestUI(0, false)
+	graph.AddRealNode(root)
+	legacy[root] = []fabric.DGNode{}
+
+	vuis := make([]UI, n)
+	for i := range vuis {
+		vuis[i] = newTestUI(i+1, true)
+		graph.AddVUI(vuis[i])
+		graph.AddRealEdge(root.ID(), vuis[i])
+		legacy[vuis[i]] = []fabric.DGNode{}
+		legacy.addEdge(root.ID(), vuis[i])
+	}
+
+	return graph, legacy, root, vuis
+}
+
+// pairs builds a graph of n UIs that each depend on their own VUI
+func pairs(n int) (*fabric.Graph, legacyGraph, []UI, []UI) {
+	graph := fabric.NewGraph()
+	legacy := make(legacyGraph)
+
+	uis := make([]UI, n)
+	vuis := make([]UI, n)
+	for i := 0; i < n; i++ {
+		uis[i] = newTestUI(2*i+1, false)
+		vuis[i] = newTestUI(2*i+2, true)
+		graph.AddRealNode(uis[i])
+		graph.AddVUI(vuis[i])
+		graph.AddRealEdge(uis[i].ID(), vuis[i])
+		legacy[uis[i]] = []fabric.DGNode{vuis[i]}
+		legacy[vuis[i]] = []fabric.DGNode{}
+	}
+
+	return graph, legacy, uis, vuis
+}
+
+var benchSizes = []int{100, 1000, 5000}
+
+func BenchmarkDependents(b *testing.B) {
+	for _, n := range benchSizes {
+		graph, legacy, _, vuis := star(n)
+
+		b.Run(fmt.Sprintf("indexed/%d", n), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				graph.Dependents(vuis[i%n])
+			}
+		})
+		b.Run(fmt.Sprintf("map-of-slices/%d", n), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				legacy.dependents(vuis[i%n])
+			}
+		})
+	}
+}
+
+// BenchmarkAddEdge adds an edge between a fresh pair of VUIs per iteration
+// (removed again outside of the timer, so the graph keeps n+1 nodes)
+func BenchmarkAddEdge(b *testing.B) {
+	for _, n := range benchSizes {
+		graph, legacy, _, _ := star(n)
+		source, dest := newTestUI(n+1, true), newTestUI(n+2, true)
+
+		b.Run(fmt.Sprintf("indexed/%d", n), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				b.StopTimer()
+				graph.AddVUI(source)
+				graph.AddVUI(dest)
+				b.StartTimer()
+				graph.AddRealEdge(source.ID(), dest)
+				b.StopTimer()
+				graph.RemoveVUI(dest)
+				graph.RemoveVUI(source)
+				b.StartTimer()
+			}
+		})
+		b.Run(fmt.Sprintf("map-of-slices/%d", n), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				b.StopTimer()
+				legacy[source] = []fabric.DGNode{}
+				legacy[dest] = []fabric.DGNode{}
+				b.StartTimer()
+				legacy.addEdge(source.ID(), dest)
+				b.StopTimer()
+				legacy.remove(dest)
+				legacy.remove(source)
+				b.StartTimer()
+			}
+		})
+	}
+}
+
+// BenchmarkRemoveNode removes every VUI of a freshly built graph; the
+// reported ns/op is per iteration (n removals)
+func BenchmarkRemoveNode(b *testing.B) {
+	for _, n := range benchSizes {
+		b.Run(fmt.Sprintf("indexed/%d", n), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				b.StopTimer()
+				graph, _, _, vuis := pairs(n)
+				b.StartTimer()
+				for _, v := range vuis {
+					if err := graph.RemoveVUI(v); err != nil {
+						b.Fatal(err)
+					}
+				}
+			}
+		})
+		b.Run(fmt.Sprintf("map-of-slices/%d", n), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				b.StopTimer()
+				_, legacy, _, vuis := pairs(n)
+				b.StartTimer()
+				for _, v := range vuis {
+					legacy.remove(v)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,104 @@
+// +build test
+
+package fabric_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/JKhawaja/fabric"
+)
+
+// TestSignalBus: signals never block the sender, and a dependent connected
+// after a signal was sent still observes it
+func TestSignalBus(t *testing.T) {
+	graph := fabric.NewGraph()
+	bus := fabric.NewSignalBus()
+	graph.SetSignalBackend(bus)
+
+	for id := 1; id <= 3; id++ {
+		if _, err := graph.AddRealNode(newTestUI(id, false)); err != nil {
+			t.Fatalf("Could not add UI node to graph: %v", err)
+		}
+	}
+	dep, _ := graph.Node(1)
+	if err := graph.AddRealEdge(2, dep); err != nil {
+		t.Fatalf("Could not add edge: %v", err)
+	}
+
+	// nobody is receiving yet
+	sent := make(chan struct{})
+	go func() {
+		dep.Signal(fabric.NodeSignal{Value: fabric.Started})
+		dep.Signal(fabric.NodeSignal{Value: fabric.Completed})
+		close(sent)
+	}()
+	select {
+	case <-sent:
+	case <-time.After(time.Second):
+		t.Fatal("Signal blocked on a dependent that was not receiving")
+	}
+
+	// the late dependent is connected after the signals were sent
+	if err := graph.AddRealEdge(3, dep); err != nil {
+		t.Fatalf("Could not add edge: %v", err)
+	}
+	for _, id := range []int{2, 3} {
+		if err := graph.Block(id, fabric.CompletionPolicy()); err != nil {
+			t.Fatalf("Node %d did not proceed: %v", id, err)
+		}
+	}
+
+	last := bus.Last(1)
+	if len(last) != 1 || last[0].Value != fabric.Completed {
+		t.Fatalf("Unexpected last values: %v", last)
+	}
+}
+
+// TestSignalBusDisconnect: queued signals are delivered before the channel is closed
+func TestSignalBusDisconnect(t *testing.T) {
+	bus := fabric.NewSignalBus()
+	send, recv := bus.Connect(1, 2)
+
+	send <- fabric.NodeSignal{Value: fabric.Started}
+	send <- fabric.NodeSignal{Value: fabric.Aborted}
+	bus.Disconnect(1, 2)
+
+	var got []fabric.Signal
+	for s := range recv {
+		got = append(got, s.Value)
+	}
+	if len(got) != 2 || got[1] != fabric.Aborted {
+		t.Fatalf("Unexpected signals: %v", got)
+	}
+}
+
+// TestChannelBackendPerGraph: removing a node does not close the channel of
+// the edge with the same node ids in another graph
+func TestChannelBackendPerGraph(t *testing.T) {
+	pair := func() (*fabric.Graph, fabric.DGNode) {
+		graph := fabric.NewGraph()
+		graph.AddVUI(newTestUI(1, true))
+		graph.AddRealNode(newTestUI(2, false))
+		dep, _ := graph.Node(1)
+		if err := graph.AddRealEdge(2, dep); err != nil {
+			t.Fatalf("Could not add edge: %v", err)
+		}
+		return graph, dep
+	}
+	a, a1 := pair()
+	b, b1 := pair()
+
+	// the dependent is done with the VUI
+	a.SetState(2, fabric.Completed)
+	if err := a.RemoveVUI(a1); err != nil {
+		t.Fatalf("Could not remove VUI: %v", err)
+	}
+
+	done := make(chan error)
+	go func() { done <- b.Block(2, fabric.CompletionPolicy()) }()
+	b1.Signal(fabric.NodeSignal{Value: fabric.Completed})
+	if err := <-done; err != nil {
+		t.Fatalf("Node did not proceed: %v", err)
+	}
+}
@@ -0,0 +1,80 @@
+// +build test
+
+package fabric_test
+
+import (
+	"testing"
+
+	"github.com/JKhawaja/fabric"
+)
+
+// ClassedProcedure is a test access type that declares its class
+type ClassedProcedure struct {
+	Procedure
+	C fabric.AccessClass
+}
+
+func (p ClassedProcedure) Class() fabric.AccessClass {
+	return p.C
+}
+
+// classedUI creates a UI whose access procedures have the given classes
+func classedUI(id int, classes ...fabric.AccessClass) UI {
+	u := newTestUI(id, false)
+	for i, c := range classes {
+		*u.AccessProcedures = append(*u.AccessProcedures, ClassedProcedure{Procedure{Id: id*10 + i}, c})
+	}
+	return u
+}
+
+func TestAccessClasses(t *testing.T) {
+	if c := fabric.ClassOf(Procedure{Id: 1}); c != fabric.WriteClass {
+		t.Fatalf("Unclassified access type has class %q", c)
+	}
+
+	graph := fabric.NewGraph()
+	r1, r2 := classedUI(1, fabric.ReadClass), classedUI(2, fabric.ReadClass)
+	w3 := classedUI(3, fabric.ReadClass, fabric.WriteClass)
+	a4, a5 := classedUI(4, "append"), classedUI(5, "append")
+
+	if graph.Conflicts(r1, r2) {
+		t.Fatal("Reads conflict")
+	}
+	if !graph.Conflicts(r1, w3) || !graph.Conflicts(a4, a5) || !graph.Conflicts(r1, newTestUI(6, false)) {
+		t.Fatal("Conflicting nodes commute")
+	}
+
+	// a VDG uses the matrix of its global graph, unless it has its own
+	m := fabric.DefaultCompatibility()
+	m.Allow("append", "append")
+	graph.SetCompatibility(m)
+	vdg, _ := fabric.NewVDG(graph)
+	if vdg.Conflicts(a4, a5) {
+		t.Fatal("VDG does not use the matrix of its global graph")
+	}
+	vdg.SetCompatibility(fabric.CompatibilityMatrix{})
+	if !vdg.Conflicts(r1, r2) {
+		t.Fatal("VDG does not use its own matrix")
+	}
+}
+
+func TestOrderOverlapsByClass(t *testing.T) {
+	graph := fabric.NewGraph()
+	r1, r2, w3 := classedUI(1, fabric.ReadClass), classedUI(2, fabric.ReadClass), classedUI(3, fabric.WriteClass)
+	for _, u := range []*UI{&r1, &r2, &w3} {
+		u.CDS = sectionOf([]int{1}, nil)
+		graph.AddRealNode(*u)
+	}
+
+	// the readers commute, but both are ordered before the writer
+	ordered, err := graph.OrderOverlaps(fabric.ByPriority)
+	if err != nil {
+		t.Fatalf("Could not order overlaps: %v", err)
+	}
+	if len(ordered) != 2 || len(graph.Dependencies(r1)) != 0 || len(graph.Dependencies(r2)) != 0 {
+		t.Fatalf("Unexpected ordered overlaps: %+v", ordered)
+	}
+	if len(graph.Dependencies(w3)) != 2 {
+		t.Fatalf("Writer is not ordered after both readers: %v", graph.Dependencies(w3))
+	}
+}
@@ -0,0 +1,102 @@
+// +build test
+
+package fabric_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/JKhawaja/fabric"
+)
+
+func nodeIDs(l fabric.NodeList) []int {
+	ids := make([]int, len(l))
+	for i, n := range l {
+		ids[i] = n.ID()
+	}
+	return ids
+}
+
+func edgeIDs(l fabric.EdgeList) []int {
+	ids := make([]int, len(l))
+	for i, e := range l {
+		ids[i] = e.ID()
+	}
+	return ids
+}
+
+func TestCoverage(t *testing.T) {
+	graph := fabric.NewGraph()
+	if graph.Covered() {
+		t.Fatal("Graph without a CDS is covered")
+	}
+	if _, err := graph.Coverage(fabric.DefaultCDS); err == nil {
+		t.Fatal("Reported the coverage of a nil CDS")
+	}
+
+	list := newListCDS(5)
+	graph.DS = list
+	nodes, edges := nodeIDs(list.Nodes), edgeIDs(list.Edges)
+
+	// UI 1 covers the first three nodes, UI 2 covers the third node again
+	u1 := newTestUI(1, false)
+	u1.CDS = sectionOf(nodes[:3], edges[:2])
+	u2 := newTestUI(2, false)
+	u2.CDS = sectionOf(nodes[2:3], nil)
+	graph.AddRealNode(u1)
+	graph.AddRealNode(u2)
+
+	report, err := graph.Coverage(fabric.DefaultCDS)
+	if err != nil {
+		t.Fatalf("Could not report coverage: %v", err)
+	}
+	expected := &fabric.CoverageReport{
+		CDS:              fabric.DefaultCDS,
+		UncoveredNodes:   nodes[3:],
+		UncoveredEdges:   edges[2:],
+		OverCoveredNodes: map[int][]int{nodes[2]: {1, 2}},
+		OverCoveredEdges: map[int][]int{},
+	}
+	if !reflect.DeepEqual(report, expected) {
+		t.Fatalf("Unexpected coverage report: %+v", report)
+	}
+
+	remainder, err := graph.CoverRemainder(fabric.DefaultCDS)
+	if err != nil || remainder == nil {
+		t.Fatalf("Could not cover the remainder: %v", err)
+	}
+	section := remainder.GetSection()
+	if !reflect.DeepEqual(nodeIDs(*section.ListNodes()), nodes[3:]) || !reflect.DeepEqual(edgeIDs(*section.ListEdges()), edges[2:]) {
+		t.Fatal("Remainder UI does not cover the uncovered nodes and edges")
+	}
+	if !graph.Covered() {
+		t.Fatal("Graph is not covered after covering the remainder")
+	}
+	if remainder, _ := graph.CoverRemainder(fabric.DefaultCDS); remainder != nil {
+		t.Fatal("Covered the remainder of a covered CDS")
+	}
+}
+
+func TestCoverageDefaultCDS(t *testing.T) {
+	// a graph with only named CDSs is covered without a default CDS
+	graph := fabric.NewGraph()
+	if err := graph.RegisterCDS("orders", newListCDS(3)); err != nil {
+		t.Fatalf("Could not register CDS: %v", err)
+	}
+	if _, err := graph.AddTotalUI("orders"); err != nil {
+		t.Fatalf("Could not add total UI: %v", err)
+	}
+	if !graph.Covered() {
+		t.Fatal("Graph without a default CDS is not covered")
+	}
+
+	// a single UI graph has its CDS as the default CDS
+	list := newListCDS(3)
+	single, err := fabric.SingleUIGraph(list)
+	if err != nil {
+		t.Fatalf("Could not create graph: %v", err)
+	}
+	if single.DS != fabric.CDS(list) || !single.Covered() {
+		t.Fatal("Single UI graph does not cover its CDS as the default CDS")
+	}
+}
@@ -0,0 +1,66 @@
+// +build test
+
+package fabric_test
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/JKhawaja/fabric"
+)
+
+// TestCriticalPath: in the diamond the path through the slower branch is critical
+func TestCriticalPath(t *testing.T) {
+	graph := diamond(t)
+	costs := map[int]time.Duration{1: 2, 2: 5, 3: 1, 4: 3}
+
+	cp, err := graph.CriticalPath(func(n fabric.DGNode) time.Duration {
+		return costs[n.ID()]
+	})
+	if err != nil {
+		t.Fatalf("Could not analyze graph: %v", err)
+	}
+	if !reflect.DeepEqual(cp.Path, []int{1, 2, 4}) {
+		t.Fatalf("Unexpected critical path: %v", cp.Path)
+	}
+	if cp.Makespan != 10 || cp.Work != 11 {
+		t.Fatalf("Unexpected makespan %v and work %v", cp.Makespan, cp.Work)
+	}
+	if cp.Parallelism != 1.1 {
+		t.Fatalf("Unexpected parallelism: %v", cp.Parallelism)
+	}
+
+	s, _ := cp.Schedule(3)
+	if s.EarliestStart != 2 || s.LatestStart != 6 || s.Slack != 4 {
+		t.Fatalf("Unexpected schedule for node 3: %+v", s)
+	}
+	s, _ = cp.Schedule(4)
+	if s.EarliestStart != 7 || s.Slack != 0 {
+		t.Fatalf("Unexpected schedule for node 4: %+v", s)
+	}
+}
+
+// TestMeasuredCriticalPath: durations measured by an Executor can be used as costs
+func TestMeasuredCriticalPath(t *testing.T) {
+	graph := diamond(t)
+	exec := fabric.NewExecutor(graph)
+	exec.Default = func(n fabric.DGNode) error {
+		if n.ID() == 3 {
+			time.Sleep(20 * time.Millisecond)
+		}
+		return nil
+	}
+
+	result, err := exec.Run()
+	if err != nil {
+		t.Fatalf("Could not run graph: %v", err)
+	}
+	cp, err := graph.CriticalPath(result.Cost())
+	if err != nil {
+		t.Fatalf("Could not analyze graph: %v", err)
+	}
+	if !reflect.DeepEqual(cp.Path, []int{1, 3, 4}) {
+		t.Fatalf("Unexpected critical path: %v", cp.Path)
+	}
+}
@@ -0,0 +1,96 @@
+// +build test
+
+package fabric_test
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/JKhawaja/fabric"
+)
+
+// TestCycleError: the cycle path is reported in dependency order
+func TestCycleError(t *testing.T) {
+	graph := fabric.NewGraph()
+	for id := 1; id <= 3; id++ {
+		if _, err := graph.AddRealNode(newTestUI(id, false)); err != nil {
+			t.Fatalf("Could not add UI node to graph: %v", err)
+		}
+	}
+	graph.AddRealEdge(1, newTestUI(2, false))
+	graph.AddRealEdge(2, newTestUI(3, false))
+	if err := graph.Cycle(); err != nil {
+		t.Fatalf("Detected a cycle in an acyclic graph: %v", err)
+	}
+
+	graph.AddRealEdge(3, newTestUI(1, false))
+	err := graph.Cycle()
+	cerr, ok := err.(*fabric.CycleError)
+	if !ok {
+		t.Fatalf("Expected a *CycleError, got %v", err)
+	}
+	if len(cerr.Path) != 3 {
+		t.Fatalf("Expected a cycle of 3 nodes, got %v", cerr.Path)
+	}
+	t.Log(cerr)
+
+	if err := graph.RejectCycles(true); err == nil {
+		t.Fatal("Enabled cycle rejection on a cyclic graph")
+	}
+}
+
+// dependsOn is a brute-force reachability check: does `from` (transitively) depend on `to`?
+func dependsOn(deps map[int][]int, from, to int) bool {
+	if from == to {
+		return true
+	}
+	for _, d := range deps[from] {
+		if dependsOn(deps, d, to) {
+			return true
+		}
+	}
+	return false
+}
+
+// TestRejectCycles: compares incremental cycle rejection against a full
+// reachability check for random edge insertions
+func TestRejectCycles(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	const size = 30
+
+	graph := fabric.NewGraph()
+	for id := 0; id < size; id++ {
+		graph.AddRealNode(newTestUI(id, false))
+	}
+	if err := graph.RejectCycles(true); err != nil {
+		t.Fatalf("Could not enable cycle rejection: %v", err)
+	}
+
+	deps := make(map[int][]int)
+	for i := 0; i < 300; i++ {
+		source, dest := r.Intn(size), r.Intn(size)
+
+		// the edge closes a cycle if dest already depends on source
+		cyclic := dependsOn(deps, dest, source)
+		if !cyclic {
+			deps[source] = append(deps[source], dest)
+		}
+
+		err := graph.AddRealEdge(source, newTestUI(dest, false))
+		if cyclic {
+			cerr, ok := err.(*fabric.CycleError)
+			if !ok {
+				t.Fatalf("Edge %d -> %d was not rejected: %v", source, dest, err)
+			}
+			if cerr.Path[0] != source || (source != dest && cerr.Path[1] != dest) {
+				t.Fatalf("Unexpected cycle path for edge %d -> %d: %v", source, dest, cerr.Path)
+			}
+		} else if err != nil {
+			t.Fatalf("Edge %d -> %d was rejected: %v", source, dest, err)
+		}
+	}
+
+	if graph.CycleDetect() {
+		t.Fatal("Graph contains a cycle")
+	}
+}
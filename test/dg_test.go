@@ -3,9 +3,8 @@
 package fabric_test
 
 import (
-	"math/rand"
+	"sync"
 	"testing"
-	"time"
 
 	"github.com/JKhawaja/fabric"
 )
@@ -23,6 +22,7 @@ type Node struct {
 type UI struct {
 	Node
 	CDS     fabric.Section
+	Store   string // name of the CDS the section belongs to
 	Unique  bool
 	Virtual bool
 }
@@ -79,6 +79,10 @@ func (u UI) IsUnique() bool {
 	return u.Unique
 }
 
+func (u UI) CDSName() string {
+	return u.Store
+}
+
 func (u UI) IsVirtual() bool {
 	return u.Virtual
 }
@@ -336,6 +340,169 @@ func TestCycleDetect(t *testing.T) {
 	}
 }
 
+// TestConcurrentTopology: adds and removes VUIs from several goroutines while
+// other goroutines read the graph (run with -race)
+func TestConcurrentTopology(t *testing.T) {
+	graph := fabric.NewGraph()
+
+	sm1 := make(fabric.SignalingMap)
+	s1 := make(fabric.SignalsMap)
+	u := UI{
+		Node: Node{
+			Id:        graph.GenID(),
+			Type:      fabric.UINode,
+			Signalers: &sm1,
+			Signals:   &s1,
+		},
+	}
+
+	up, err := graph.AddRealNode(u)
+	if err != nil {
+		t.Fatalf("Could not add UI node to graph: %v", err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(2)
+
+		// writer
+		go func(id int) {
+			defer wg.Done()
+			sm := make(fabric.SignalingMap)
+			s := make(fabric.SignalsMap)
+			vu := UI{
+				Node: Node{
+					Id:        id,
+					Type:      fabric.VUINode,
+					Signalers: &sm,
+					Signals:   &s,
+				},
+				Virtual: true,
+			}
+
+			vup, err := graph.AddVUI(vu)
+			if err != nil {
+				t.Errorf("Could not add VUI node to graph: %v", err)
+				return
+			}
+			graph.AddRealEdge(vu.ID(), up)
+
+			if err := graph.RemoveVUI(vup); err == nil {
+				t.Errorf("Removed a VUI that still has dependencies")
+			}
+		}(i + 1000)
+
+		// reader
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				graph.Dependents(up)
+				graph.GetAdjacents(up)
+				for _, n := range graph.Nodes() {
+					graph.Dependencies(n)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	if len(graph.Dependents(up)) != 8 {
+		t.Fatalf("Expected 8 dependents, got %d", len(graph.Dependents(up)))
+	}
+}
+
+// TestRemoveRealEdge: the edge and its signaling channel are removed from both endpoints
+func TestRemoveRealEdge(t *testing.T) {
+	graph := fabric.NewGraph()
+	u1 := newTestUI(1, false)
+	u2 := newTestUI(2, false)
+	graph.AddRealNode(u1)
+	graph.AddRealNode(u2)
+	graph.AddRealEdge(2, u1)
+
+	// a node without a recorded state may be waiting on its dependencies
+	if err := graph.RemoveRealEdge(2, u1); err == nil {
+		t.Fatal("Removed an edge that a node may be waiting on")
+	}
+
+	c := u2.ListSignals()[1]
+	graph.SetState(2, fabric.Completed)
+	if err := graph.RemoveRealEdge(2, u1); err != nil {
+		t.Fatalf("Could not remove edge: %v", err)
+	}
+	if len(graph.Dependencies(u2)) != 0 || len(graph.Dependents(u1)) != 0 {
+		t.Fatal("Edge is still in the graph")
+	}
+	if len(u1.ListSignalers()) != 0 || len(u2.ListSignals()) != 0 {
+		t.Fatal("Signaling maps still hold the edge")
+	}
+	if _, ok := <-c; ok {
+		t.Fatal("Retired channel was not closed")
+	}
+
+	if err := graph.RemoveRealEdge(3, u1); err == nil {
+		t.Fatal("Removed an edge from a node that does not exist")
+	}
+}
+
+// TestRemoveVUIWaiting: a VUI is not removed while a dependent may be waiting on it
+func TestRemoveVUIWaiting(t *testing.T) {
+	graph := fabric.NewGraph()
+	vui := newTestUI(1, true)
+	graph.AddVUI(vui)
+	graph.AddRealNode(newTestUI(2, false))
+	graph.AddRealEdge(2, vui)
+
+	if err := graph.RemoveVUI(vui); err == nil {
+		t.Fatal("Removed a VUI that a dependent may be waiting on")
+	}
+	graph.SetState(2, fabric.Completed)
+	if err := graph.RemoveVUI(vui); err != nil {
+		t.Fatalf("Could not remove VUI: %v", err)
+	}
+}
+
+// TestRemoveRealNode: a node is removed with all of its edges, unless a dependent is waiting on it
+func TestRemoveRealNode(t *testing.T) {
+	graph := fabric.NewGraph()
+	nodes := make([]UI, 4)
+	for i := range nodes {
+		nodes[i] = newTestUI(i+1, false)
+		graph.AddRealNode(nodes[i])
+	}
+	// 3 -> 2 -> 1, 4 -> 2
+	graph.AddRealEdge(2, nodes[0])
+	graph.AddRealEdge(3, nodes[1])
+	graph.AddRealEdge(4, nodes[1])
+
+	graph.SetState(3, fabric.Waiting)
+	if err := graph.RemoveRealNode(nodes[1]); err == nil {
+		t.Fatal("Removed a node that a dependent is waiting on")
+	}
+
+	// 4 has no recorded state
+	graph.SetState(3, fabric.Aborted)
+	if err := graph.RemoveRealNode(nodes[1]); err == nil {
+		t.Fatal("Removed a node that a dependent may be waiting on")
+	}
+
+	graph.SetState(4, fabric.Completed)
+	if err := graph.RemoveRealNode(nodes[1]); err != nil {
+		t.Fatalf("Could not remove node: %v", err)
+	}
+	if _, ok := graph.Node(2); ok {
+		t.Fatal("Node is still in the graph")
+	}
+	if len(graph.Nodes()) != 3 || len(graph.Dependents(nodes[0])) != 0 {
+		t.Fatalf("Unexpected graph after removal: %v", graph.Nodes())
+	}
+	for _, u := range nodes {
+		if len(u.ListSignals()) != 0 || len(u.ListSignalers()) != 0 {
+			t.Fatalf("Node %d still has signaling channels", u.ID())
+		}
+	}
+}
+
 /* CDS Testing */
 
 // ElementNode satisfies fabric.Node interface
@@ -389,10 +556,11 @@ type List struct {
 	Len   int
 	Nodes fabric.NodeList
 	Edges fabric.EdgeList
+	IDs   *fabric.Counter
 }
 
 func NewList() *List {
-	l := List{}
+	l := List{IDs: fabric.NewCounter(1)}
 	n := &ElementNode{
 		Id: l.GenNodeID(),
 		L:  &l,
@@ -448,29 +616,22 @@ func (l *List) NewElementEdge(s, d *ElementNode) {
 
 // Generate an ID for a CDS Node
 func (l List) GenNodeID() int {
-	rand.Seed(time.Now().UnixNano())
-	id := rand.Int()
-	for _, n := range l.Nodes {
-		if n.ID() == id {
-			id = l.GenNodeID()
+	for {
+		id, _ := l.IDs.Next() // a Counter never fails
+		if !fabric.ContainsNode(l.Nodes, ElementNode{Id: id}) {
+			return id
 		}
 	}
-
-	return id
 }
 
 // Generate an ID for a CDS Edge
 func (l List) GenEdgeID() int {
-	rand.Seed(time.Now().UnixNano())
-	id := rand.Int()
-	for _, e := range l.Edges {
-		if e.ID() == id {
-			id = l.GenEdgeID()
+	for {
+		id, _ := l.IDs.Next() // a Counter never fails
+		if !fabric.ContainsEdge(l.Edges, ElementEdge{Id: id}) {
+			return id
 		}
 	}
-
-	return id
-
 }
 
 func (l List) ListNodes() fabric.NodeList {
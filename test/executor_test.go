@@ -0,0 +1,84 @@
+// +build test
+
+package fabric_test
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/JKhawaja/fabric"
+)
+
+// diamond builds a graph where 4 depends on 2 and 3, which both depend on 1
+func diamond(t *testing.T) *fabric.Graph {
+	graph := fabric.NewGraph()
+	for id := 1; id <= 4; id++ {
+		if _, err := graph.AddRealNode(newTestUI(id, false)); err != nil {
+			t.Fatalf("Could not add UI node to graph: %v", err)
+		}
+	}
+	graph.AddRealEdge(4, newTestUI(3, false))
+	graph.AddRealEdge(4, newTestUI(2, false))
+	graph.AddRealEdge(3, newTestUI(1, false))
+	graph.AddRealEdge(2, newTestUI(1, false))
+
+	return graph
+}
+
+// TestExecutor: every node runs after its dependencies
+func TestExecutor(t *testing.T) {
+	graph := diamond(t)
+
+	var mu sync.Mutex
+	var ran []int
+	exec := fabric.NewExecutor(graph)
+	exec.Default = func(n fabric.DGNode) error {
+		mu.Lock()
+		defer mu.Unlock()
+		ran = append(ran, n.ID())
+		return nil
+	}
+
+	result, err := exec.Run()
+	if err != nil {
+		t.Fatalf("Could not run graph: %v", err)
+	}
+	if result.Err() != nil {
+		t.Fatalf("Execution failed: %v", result.Err())
+	}
+	if !reflect.DeepEqual(result.Completed, []int{1, 2, 3, 4}) {
+		t.Fatalf("Unexpected completed nodes: %v", result.Completed)
+	}
+	if ran[0] != 1 || ran[3] != 4 {
+		t.Fatalf("Nodes ran out of order: %v", ran)
+	}
+}
+
+// TestExecutorAbort: a failing node aborts its transitive dependents
+func TestExecutorAbort(t *testing.T) {
+	graph := diamond(t)
+
+	exec := fabric.NewExecutor(graph)
+	exec.Default = func(n fabric.DGNode) error {
+		return nil
+	}
+	exec.Handle(2, func(n fabric.DGNode) error {
+		return fmt.Errorf("failure")
+	})
+
+	result, err := exec.Run()
+	if err != nil {
+		t.Fatalf("Could not run graph: %v", err)
+	}
+	if !reflect.DeepEqual(result.Completed, []int{1, 3}) {
+		t.Fatalf("Unexpected completed nodes: %v", result.Completed)
+	}
+	if !reflect.DeepEqual(result.Aborted, []int{2, 4}) {
+		t.Fatalf("Unexpected aborted nodes: %v", result.Aborted)
+	}
+	if _, ok := result.Errors[2]; !ok || len(result.Errors) != 1 {
+		t.Fatalf("Unexpected errors: %v", result.Errors)
+	}
+}
@@ -0,0 +1,173 @@
+// +build test
+
+package fabric_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/JKhawaja/fabric"
+)
+
+var update = flag.Bool("update", false, "update the golden files in testdata")
+
+// golden compares output with a file in testdata (or overwrites the file with -update)
+func golden(t *testing.T, name string, output []byte) {
+	path := filepath.Join("testdata", name)
+	if *update {
+		if err := ioutil.WriteFile(path, output, 0644); err != nil {
+			t.Fatalf("Could not update golden file: %v", err)
+		}
+	}
+
+	expected, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Could not read golden file: %v", err)
+	}
+	if !bytes.Equal(output, expected) {
+		t.Fatalf("Output does not match %s:\n%s", path, output)
+	}
+}
+
+// sectionOf creates a test section with the given CDS node and edge ids
+func sectionOf(nodeIDs, edgeIDs []int) fabric.Section {
+	nodes := make(fabric.NodeList, 0)
+	for _, id := range nodeIDs {
+		nodes = append(nodes, ElementNode{Id: id})
+	}
+	edges := make(fabric.EdgeList, 0)
+	for _, id := range edgeIDs {
+		edges = append(edges, ElementEdge{Id: id})
+	}
+
+	return &fabric.Subgraph{Nodes: &nodes, Edges: &edges}
+}
+
+// exportGraph builds a small graph with a UI that has a section, and a VUI
+func exportGraph(t *testing.T) *fabric.Graph {
+	graph := fabric.NewGraph()
+
+	u1 := newTestUI(1, false)
+	u1.CDS = sectionOf([]int{11, 10}, []int{20})
+	*u1.AccessProcedures = fabric.ProcedureList{Procedure{Id: 7}}
+	u2 := newTestUI(2, false)
+	v3 := newTestUI(3, true)
+	*v3.AccessProcedures = fabric.ProcedureList{Procedure{Id: 8}, Procedure{Id: 7}}
+
+	for _, u := range []UI{v3, u1, u2} {
+		if _, err := graph.AddRealNode(u); err != nil {
+			t.Fatalf("Could not add node to graph: %v", err)
+		}
+	}
+	graph.AddRealEdge(3, u2)
+	graph.AddRealEdge(3, u1)
+	graph.AddRealEdge(2, u1)
+
+	return graph
+}
+
+func TestGraphDOT(t *testing.T) {
+	var b bytes.Buffer
+	if err := exportGraph(t).WriteDOT(&b); err != nil {
+		t.Fatalf("Could not write DOT: %v", err)
+	}
+	golden(t, "graph.dot", b.Bytes())
+}
+
+func TestGraphJSON(t *testing.T) {
+	var b bytes.Buffer
+	if err := exportGraph(t).WriteJSON(&b); err != nil {
+		t.Fatalf("Could not write JSON: %v", err)
+	}
+	golden(t, "graph.json", b.Bytes())
+}
+
+// TestNodeTypeJSON: only the export documents name node types; a NodeType
+// itself is still encoded as a number
+func TestNodeTypeJSON(t *testing.T) {
+	b, err := json.Marshal(fabric.VUINode)
+	if err != nil {
+		t.Fatalf("Could not encode node type: %v", err)
+	}
+	if string(b) != "3" {
+		t.Fatalf("Unexpected encoding of a node type: %s", b)
+	}
+}
+
+func TestVDGDOT(t *testing.T) {
+	vdg, err := fabric.NewVDG(fabric.NewGraph())
+	if err != nil {
+		t.Fatalf("Could not create VDG: %v", err)
+	}
+	space := newTestUI(5, true)
+	var nodes []Virtual
+	for id := 1; id <= 3; id++ {
+		sm := make(fabric.SignalingMap)
+		s := make(fabric.SignalsMap)
+		p := make(fabric.ProcedureList, 0)
+		v := Virtual{
+			Node:  Node{Id: id, Type: fabric.VDGNode, Signalers: &sm, Signals: &s, AccessProcedures: &p},
+			Space: space,
+		}
+		vdg.AddVirtualNode(v)
+		nodes = append(nodes, v)
+	}
+	vdg.AddVirtualEdge(2, nodes[0])
+	vdg.AddVirtualEdge(3, nodes[1])
+
+	var b bytes.Buffer
+	if err := vdg.WriteDOT(&b); err != nil {
+		t.Fatalf("Could not write DOT: %v", err)
+	}
+	golden(t, "vdg.dot", b.Bytes())
+}
+
+// TestLoadGraph: a graph loaded from JSON has the same document as the original
+func TestLoadGraph(t *testing.T) {
+	graph := exportGraph(t)
+	var b bytes.Buffer
+	if err := graph.WriteJSON(&b); err != nil {
+		t.Fatalf("Could not write JSON: %v", err)
+	}
+
+	factory := func(doc fabric.NodeDocument) (fabric.DGNode, error) {
+		u := newTestUI(doc.ID, doc.Type == fabric.VUINode.String())
+		for _, id := range doc.Procedures {
+			*u.AccessProcedures = append(*u.AccessProcedures, Procedure{Id: id})
+		}
+		if doc.Section != nil {
+			u.CDS = sectionOf(doc.Section.Nodes, doc.Section.Edges)
+		}
+		return u, nil
+	}
+	factories := map[fabric.NodeType]fabric.NodeFactory{
+		fabric.UINode:  factory,
+		fabric.VUINode: factory,
+	}
+
+	loaded, err := fabric.LoadGraph(&b, factories)
+	if err != nil {
+		t.Fatalf("Could not load graph: %v", err)
+	}
+	if !reflect.DeepEqual(loaded.Document(), graph.Document()) {
+		t.Fatalf("Loaded graph differs:\n%v\n%v", loaded.Document(), graph.Document())
+	}
+
+	// the signaling channels are rebuilt as well
+	u3, _ := loaded.Node(3)
+	if len(u3.ListSignals()) != 2 {
+		t.Fatalf("Loaded node has %d signal channels", len(u3.ListSignals()))
+	}
+
+	delete(factories, fabric.VUINode)
+	b.Reset()
+	graph.WriteJSON(&b)
+	if _, err := fabric.LoadGraph(&b, factories); err == nil {
+		t.Fatal("Loaded a graph without a factory for every node type")
+	}
+}
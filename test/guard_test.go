@@ -0,0 +1,48 @@
+// +build test
+
+package fabric_test
+
+import (
+	"testing"
+
+	"github.com/JKhawaja/fabric"
+)
+
+func TestGuard(t *testing.T) {
+	read, update := Procedure{Id: 1}, Procedure{Id: 2}
+	u := newTestUI(1, true)
+	*u.AccessProcedures = fabric.ProcedureList{read}
+
+	guard := fabric.NewGuard(false)
+	ran := 0
+	call := func() error {
+		ran++
+		return nil
+	}
+
+	if err := guard.Invoke(u, read, call); err != nil || ran != 1 {
+		t.Fatalf("Listed access procedure did not run: %v", err)
+	}
+	err := guard.Invoke(u, update, call)
+	perr, ok := err.(*fabric.PermissionError)
+	if !ok || perr.Node != 1 || perr.AccessType != 2 {
+		t.Fatalf("Expected a *PermissionError, got %v", err)
+	}
+	if ran != 1 || guard.Violations() != 1 {
+		t.Fatalf("Unlisted access procedure ran %d times, %d violations", ran-1, guard.Violations())
+	}
+
+	// strict mode panics
+	guard.Strict = true
+	func() {
+		defer func() {
+			if r := recover(); r == nil {
+				t.Fatal("Strict guard did not panic")
+			}
+		}()
+		guard.Invoke(u, update, call)
+	}()
+	if ran != 1 || guard.Violations() != 2 {
+		t.Fatalf("Unlisted access procedure ran %d times, %d violations", ran-1, guard.Violations())
+	}
+}
@@ -0,0 +1,219 @@
+// +build test
+
+package fabric_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/JKhawaja/fabric"
+)
+
+// blockedUI returns a UI that depends on n dependencies, and the channels
+// used to send it signals from each dependency
+func blockedUI(n int) (UI, []chan fabric.NodeSignal) {
+	u := newTestUI(1, false)
+	signals := make(fabric.SignalsMap)
+	var channels []chan fabric.NodeSignal
+	for i := 0; i < n; i++ {
+		c := make(chan fabric.NodeSignal)
+		signals[100+i] = c
+		channels = append(channels, c)
+	}
+	u.UpdateSignaling(u.ListSignalers(), signals)
+
+	return u, channels
+}
+
+func send(c chan fabric.NodeSignal, values ...fabric.Signal) {
+	for _, v := range values {
+		c <- fabric.NodeSignal{Value: v}
+	}
+}
+
+func TestCompletionPolicy(t *testing.T) {
+	u, channels := blockedUI(2)
+	policy := fabric.CompletionPolicy()
+	policy.Delay = nil
+
+	go send(channels[0], fabric.Waiting, fabric.Started, fabric.Completed)
+	go send(channels[1], fabric.Started, fabric.AbortRetry, fabric.AbortRetry, fabric.Completed)
+	if err := fabric.Await(u, policy); err != nil {
+		t.Fatalf("Node did not proceed: %v", err)
+	}
+
+	go send(channels[0], fabric.Started, fabric.Completed)
+	go send(channels[1], fabric.Started, fabric.Aborted)
+	err := fabric.Await(u, policy)
+	aerr, ok := err.(*fabric.AbortError)
+	if !ok {
+		t.Fatalf("Expected an *AbortError, got %v", err)
+	}
+	if aerr.Dependency != 101 || aerr.Signal.Value != fabric.Aborted {
+		t.Fatalf("Unexpected abort: %v", aerr)
+	}
+
+	// too many retries
+	policy.MaxRetries = 1
+	go send(channels[0], fabric.Completed)
+	go send(channels[1], fabric.AbortRetry, fabric.AbortRetry, fabric.Completed)
+	if err := fabric.Await(u, policy); err == nil {
+		t.Fatal("Node proceeded after too many retries")
+	}
+}
+
+func TestStartPolicy(t *testing.T) {
+	u, channels := blockedUI(1)
+
+	done := make(chan struct{})
+	go func() {
+		send(channels[0], fabric.Started)
+		// the dependency must not be blocked after the node proceeded
+		send(channels[0], fabric.Completed)
+		close(done)
+	}()
+	if err := fabric.Await(u, fabric.StartPolicy()); err != nil {
+		t.Fatalf("Node did not proceed: %v", err)
+	}
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Dependency is blocked on its signal channel")
+	}
+}
+
+func TestHelpPolicy(t *testing.T) {
+	u, channels := blockedUI(1)
+
+	var helped []int
+	policy := fabric.CompletionPolicy()
+	policy.Helper = func(dependency int, s fabric.NodeSignal) {
+		helped = append(helped, dependency)
+	}
+
+	go send(channels[0], fabric.Help, fabric.Completed)
+	if err := fabric.Await(u, policy); err != nil {
+		t.Fatalf("Node did not proceed: %v", err)
+	}
+	if len(helped) != 1 || helped[0] != 100 {
+		t.Fatalf("Helping mechanism was not triggered: %v", helped)
+	}
+}
+
+// TestTotalBlock: the BasicSignalHandler's wg.Done() reaches TotalBlock, and
+// the node is recorded as Waiting while it blocks
+func TestTotalBlock(t *testing.T) {
+	graph := fabric.NewGraph()
+	u, channels := blockedUI(1)
+	if _, err := graph.AddRealNode(u); err != nil {
+		t.Fatalf("Could not add UI node to graph: %v", err)
+	}
+	graph.SetState(u.ID(), fabric.Completed)
+
+	go send(channels[0], fabric.Completed)
+	var blocked fabric.Signal
+	handler := func(c <-chan fabric.NodeSignal, wg *sync.WaitGroup) {
+		blocked, _ = graph.State(u.ID())
+		<-c
+		wg.Done()
+	}
+	if !graph.TotalBlock(u.ID(), handler) {
+		t.Fatal("TotalBlock did not return true")
+	}
+	if s, _ := graph.State(u.ID()); blocked != fabric.Waiting || s != fabric.Started {
+		t.Fatalf("Unexpected states: %v while blocked, %v after", blocked, s)
+	}
+}
+
+// TestBlockContext: a node stops blocking when its context is done, reports
+// the outstanding dependencies and aborts its own dependents
+func TestBlockContext(t *testing.T) {
+	u, channels := blockedUI(2)
+	dependent := make(chan fabric.NodeSignal)
+	u.UpdateSignaling(fabric.SignalingMap{2: dependent}, u.ListSignals())
+
+	go send(channels[0], fabric.Completed)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	err := fabric.AwaitContext(ctx, u, fabric.CompletionPolicy())
+	berr, ok := err.(*fabric.BlockError)
+	if !ok {
+		t.Fatalf("Expected a *BlockError, got %v", err)
+	}
+	if len(berr.Outstanding) != 1 || berr.Outstanding[0] != 101 {
+		t.Fatalf("Unexpected outstanding dependencies: %v", berr.Outstanding)
+	}
+	if berr.Unwrap() != context.DeadlineExceeded {
+		t.Fatalf("Unexpected context error: %v", berr.Err)
+	}
+
+	select {
+	case s := <-dependent:
+		if s.Value != fabric.Aborted {
+			t.Fatalf("Dependent received %v instead of Aborted", s.Value)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Dependent was not aborted")
+	}
+}
+
+// TestAwaitAbort: once a dependency aborts the node, the node stops reacting
+// to its other dependencies (which are only drained)
+func TestAwaitAbort(t *testing.T) {
+	u, channels := blockedUI(2)
+
+	var mu sync.Mutex
+	var helped []int
+	policy := fabric.CompletionPolicy()
+	policy.Helper = func(dependency int, s fabric.NodeSignal) {
+		mu.Lock()
+		defer mu.Unlock()
+		helped = append(helped, dependency)
+	}
+
+	go send(channels[0], fabric.Aborted)
+	if _, ok := fabric.Await(u, policy).(*fabric.AbortError); !ok {
+		t.Fatal("Node was not aborted")
+	}
+	send(channels[1], fabric.Help, fabric.Completed)
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(helped) != 0 {
+		t.Fatalf("Aborted node still reacted to its dependencies: %v", helped)
+	}
+}
+
+// TestBlockAbort: a node aborted by a dependency aborts its own dependents
+func TestBlockAbort(t *testing.T) {
+	graph := fabric.NewGraph()
+	for id := 1; id <= 3; id++ {
+		if _, err := graph.AddRealNode(newTestUI(id, false)); err != nil {
+			t.Fatalf("Could not add UI node to graph: %v", err)
+		}
+	}
+	graph.AddRealEdge(2, newTestUI(1, false))
+	graph.AddRealEdge(3, newTestUI(2, false))
+
+	n1, _ := graph.Node(1)
+	n3, _ := graph.Node(3)
+	dependent := make(chan fabric.Signal, 1)
+	go func() { dependent <- (<-n3.ListSignals()[2]).Value }()
+
+	go n1.Signal(fabric.NodeSignal{Value: fabric.Aborted})
+	if _, ok := graph.Block(2, fabric.CompletionPolicy()).(*fabric.AbortError); !ok {
+		t.Fatal("Node was not aborted")
+	}
+	select {
+	case s := <-dependent:
+		if s != fabric.Aborted {
+			t.Fatalf("Dependent received %v instead of Aborted", s)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Dependent was not aborted")
+	}
+}
@@ -0,0 +1,28 @@
+// +build test
+
+package fabric_test
+
+import (
+	"github.com/JKhawaja/fabric"
+)
+
+// newTestUI returns a UI (or VUI) node with empty signaling maps
+func newTestUI(id int, virtual bool) UI {
+	sm := make(fabric.SignalingMap)
+	s := make(fabric.SignalsMap)
+	p := make(fabric.ProcedureList, 0)
+	t := fabric.UINode
+	if virtual {
+		t = fabric.VUINode
+	}
+	return UI{
+		Node: Node{
+			Id:               id,
+			Type:             t,
+			Signalers:        &sm,
+			Signals:          &s,
+			AccessProcedures: &p,
+		},
+		Virtual: virtual,
+	}
+}
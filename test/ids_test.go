@@ -0,0 +1,127 @@
+// +build test
+
+package fabric_test
+
+import (
+	"errors"
+	"reflect"
+	"strconv"
+	"testing"
+
+	"github.com/JKhawaja/fabric"
+)
+
+// TestIDAllocators: allocators are deterministic and namespaces never overlap
+func TestIDAllocators(t *testing.T) {
+	next := func(a fabric.IDAllocator) int {
+		id, err := a.Next()
+		if err != nil {
+			t.Fatalf("Could not allocate id: %v", err)
+		}
+		return id
+	}
+
+	c := fabric.NewCounter(5)
+	if a, b := next(c), next(c); a != 5 || b != 6 {
+		t.Fatalf("Unexpected counter ids: %d, %d", a, b)
+	}
+
+	r1 := fabric.NewRandomAllocator(42)
+	r2 := fabric.NewRandomAllocator(42)
+	for i := 0; i < 10; i++ {
+		if a, b := next(r1), next(r2); a != b {
+			t.Fatalf("Equal seeds produced different ids: %d, %d", a, b)
+		}
+	}
+
+	n1, err := fabric.NewNamespace(1)
+	if strconv.IntSize < 64 {
+		if err == nil {
+			t.Fatal("Namespace was created with 32-bit ints")
+		}
+		return
+	}
+	if err != nil {
+		t.Fatalf("Could not create namespace: %v", err)
+	}
+	n2, _ := fabric.NewNamespace(2)
+	a, b := next(n1), next(n2)
+	if a == b || fabric.NamespaceOf(a) != 1 || fabric.NamespaceOf(b) != 2 {
+		t.Fatalf("Unexpected namespaced ids: %d, %d", a, b)
+	}
+	if _, err := fabric.NewNamespace(-1); err == nil {
+		t.Fatal("Negative namespace was accepted")
+	}
+	overflow := 1
+	overflow <<= 31
+	if _, err := fabric.NewNamespace(overflow); err == nil {
+		t.Fatal("Namespace that overflows an int was accepted")
+	}
+}
+
+// TestGenID: graphs share the default allocator, and skip ids already in use
+func TestGenID(t *testing.T) {
+	fabric.SetDefaultIDAllocator(fabric.NewCounter(1))
+	defer fabric.SetDefaultIDAllocator(fabric.NewCounter(1))
+
+	g1 := fabric.NewGraph()
+	g2 := fabric.NewGraph()
+	g1.AddRealNode(newTestUI(1, false))
+
+	ids := []int{g1.GenID(), g2.GenID(), g1.GenID()}
+	if !reflect.DeepEqual(ids, []int{2, 3, 4}) {
+		t.Fatalf("Unexpected ids: %v", ids)
+	}
+
+	// a VDG uses the allocator of its global graph
+	ns, err := fabric.NewNamespace(7)
+	if err != nil {
+		// namespaces need 64-bit ints
+		return
+	}
+	g3 := fabric.NewGraphWithAllocator(ns)
+	vdg, _ := fabric.NewVDG(g3)
+	if id := vdg.GenID(); fabric.NamespaceOf(id) != 7 {
+		t.Fatalf("VDG id %d is not in the graph's namespace", id)
+	}
+}
+
+// releaser is a Counter that records the ids it is given back
+type releaser struct {
+	*fabric.Counter
+	released []int
+}
+
+func (r *releaser) Release(id int) {
+	r.released = append(r.released, id)
+}
+
+// failing is an allocator that has run out of ids
+type failing struct{}
+
+func (failing) Next() (int, error) {
+	return 0, errors.New("No ids left.")
+}
+
+// TestReleaseID: removed nodes give their ids back to the allocator, and
+// allocator errors are reported by NextID
+func TestReleaseID(t *testing.T) {
+	r := &releaser{Counter: fabric.NewCounter(1)}
+	graph := fabric.NewGraphWithAllocator(r)
+	id, err := graph.NextID()
+	if err != nil {
+		t.Fatalf("Could not allocate id: %v", err)
+	}
+	u := newTestUI(id, true)
+	graph.AddVUI(u)
+	if err := graph.RemoveVUI(u); err != nil {
+		t.Fatalf("Could not remove VUI: %v", err)
+	}
+	if !reflect.DeepEqual(r.released, []int{id}) {
+		t.Fatalf("Unexpected released ids: %v", r.released)
+	}
+
+	if _, err := fabric.NewGraphWithAllocator(failing{}).NextID(); err == nil {
+		t.Fatal("Allocator error was not reported")
+	}
+}
@@ -0,0 +1,80 @@
+// +build test
+
+package fabric_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/JKhawaja/fabric"
+)
+
+// NodeUpdate is a test access type that only writes a single CDS node
+type NodeUpdate struct {
+	ClassedProcedure
+	Target int
+}
+
+func (u NodeUpdate) InvariantNode(n fabric.Node) bool {
+	return n.ID() != u.Target
+}
+
+func (u NodeUpdate) InvariantEdge(fabric.Edge) bool {
+	return true
+}
+
+func TestInvariantSets(t *testing.T) {
+	section := sectionOf([]int{1, 2, 3}, []int{10})
+	update := NodeUpdate{ClassedProcedure{Procedure{Id: 1}, fabric.WriteClass}, 2}
+
+	nodes, edges := fabric.InvariantSets(update, section)
+	if !reflect.DeepEqual(nodeIDs(nodes), []int{1, 3}) || !reflect.DeepEqual(edgeIDs(edges), []int{10}) {
+		t.Fatalf("Unexpected invariant sets: %v %v", nodeIDs(nodes), edgeIDs(edges))
+	}
+	nodes, edges = fabric.WriteSets(update, section)
+	if !reflect.DeepEqual(nodeIDs(nodes), []int{2}) || len(edges) != 0 {
+		t.Fatalf("Unexpected write sets: %v %v", nodeIDs(nodes), edgeIDs(edges))
+	}
+
+	// without Invariant, reads leave everything invariant and writes nothing
+	read := ClassedProcedure{Procedure{Id: 2}, fabric.ReadClass}
+	if nodes, edges := fabric.WriteSets(read, section); len(nodes)+len(edges) != 0 {
+		t.Fatal("Read procedure writes its section")
+	}
+	if nodes, edges := fabric.InvariantSets(Procedure{Id: 3}, section); len(nodes)+len(edges) != 0 {
+		t.Fatal("Unclassified procedure leaves its section invariant")
+	}
+}
+
+// TestDisjointWriteSets: updates that only write what the other does not access are not ordered
+func TestDisjointWriteSets(t *testing.T) {
+	graph := fabric.NewGraph()
+	updateUI := func(id int, nodes []int, target int) UI {
+		u := newTestUI(id, false)
+		u.CDS = sectionOf(nodes, nil)
+		*u.AccessProcedures = fabric.ProcedureList{NodeUpdate{ClassedProcedure{Procedure{Id: id}, fabric.WriteClass}, target}}
+		return u
+	}
+
+	// both read node 2, but 1 only writes node 1 and 2 only writes node 3
+	u1 := updateUI(1, []int{1, 2}, 1)
+	u2 := updateUI(2, []int{2, 3}, 3)
+	graph.AddRealNode(u1)
+	graph.AddRealNode(u2)
+	if graph.Conflicts(u1, u2) {
+		t.Fatal("Updates with disjoint write sets conflict")
+	}
+	if ordered, _ := graph.OrderOverlaps(fabric.ByPriority); len(ordered) != 0 {
+		t.Fatalf("Ordered updates with disjoint write sets: %+v", ordered)
+	}
+
+	// an update of node 2 conflicts with both
+	u3 := updateUI(3, []int{2}, 2)
+	graph.AddRealNode(u3)
+	if !graph.Conflicts(u1, u3) || !graph.Conflicts(u2, u3) {
+		t.Fatal("Update of a shared node does not conflict")
+	}
+	if ordered, _ := graph.OrderOverlaps(fabric.ByPriority); len(ordered) != 2 {
+		t.Fatalf("Unexpected ordered overlaps: %+v", ordered)
+	}
+}
@@ -0,0 +1,118 @@
+// +build test
+
+package fabric_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/JKhawaja/fabric"
+)
+
+// newListCDS creates a list CDS with n nodes in a chain
+func newListCDS(n int) *List {
+	list := NewList()
+	prev := list.Root
+	for i := 1; i < n; i++ {
+		next := list.NewElementNode()
+		list.NewElementEdge(prev, next)
+		prev = next
+	}
+	return list
+}
+
+// listSection returns a section over the nodes and edges of a list from the given node on
+func listSection(l *List, from int) fabric.Section {
+	nodes := append(fabric.NodeList{}, l.Nodes[from:]...)
+	edges := append(fabric.EdgeList{}, l.Edges[from:]...)
+	return fabric.NewDisjoint(&nodes, &edges)
+}
+
+func storeUI(id int, store string, section fabric.Section) UI {
+	u := newTestUI(id, false)
+	u.Store = store
+	u.CDS = section
+	return u
+}
+
+func TestMultipleCDS(t *testing.T) {
+	users, orders := newListCDS(3), newListCDS(3)
+
+	graph := fabric.NewGraph()
+	graph.DS = users
+	if err := graph.RegisterCDS("orders", orders); err != nil {
+		t.Fatalf("Could not register CDS: %v", err)
+	}
+	if err := graph.RegisterCDS("orders", users); err == nil {
+		t.Fatal("Registered a CDS name twice")
+	}
+	if err := graph.RegisterCDS(fabric.DefaultCDS, orders); err == nil {
+		t.Fatal("Registered the default CDS")
+	}
+	if names := graph.CDSNames(); !reflect.DeepEqual(names, []string{fabric.DefaultCDS, "orders"}) {
+		t.Fatalf("Unexpected CDS names: %v", names)
+	}
+
+	// the users UI covers all of users; the orders UI misses the root of orders
+	u1 := storeUI(1, fabric.DefaultCDS, listSection(users, 0))
+	u2 := storeUI(2, "orders", listSection(orders, 1))
+	graph.AddRealNode(u1)
+	graph.AddRealNode(u2)
+
+	// node and edge ids overlap between the CDSs, but a UI only covers its own CDS
+	if !graph.CoveredCDS(fabric.DefaultCDS) {
+		t.Fatal("Users CDS is not covered")
+	}
+	if graph.CoveredCDS("orders") || graph.Covered() {
+		t.Fatal("Orders CDS is incorrectly covered")
+	}
+
+	u3 := storeUI(3, "orders", listSection(orders, 0))
+	graph.AddRealNode(u3)
+	if !graph.Covered() {
+		t.Fatal("Graph is not covered")
+	}
+
+	// a request that touches both CDSs depends on UIs of both
+	request := newTestUI(4, true)
+	graph.AddVUI(request)
+	if err := graph.AddRealEdge(4, u1); err != nil {
+		t.Fatalf("Could not add cross-CDS edge: %v", err)
+	}
+	if err := graph.AddRealEdge(4, u3); err != nil {
+		t.Fatalf("Could not add cross-CDS edge: %v", err)
+	}
+	if deps := graph.Dependencies(request); len(deps) != 2 {
+		t.Fatalf("Unexpected dependencies: %v", deps)
+	}
+}
+
+func TestSingleUIGraphs(t *testing.T) {
+	users, orders := newListCDS(2), newListCDS(4)
+
+	graph, err := fabric.SingleUIGraphs(map[string]fabric.CDS{
+		fabric.DefaultCDS: users,
+		"orders":          orders,
+	})
+	if err != nil {
+		t.Fatalf("Could not create graph: %v", err)
+	}
+
+	nodes := graph.Nodes()
+	if len(nodes) != 2 {
+		t.Fatalf("Unexpected number of UIs: %d", len(nodes))
+	}
+	stores := make(map[string]bool)
+	for _, n := range nodes {
+		stores[fabric.CDSOf(n.(fabric.UI))] = true
+	}
+	if !stores[fabric.DefaultCDS] || !stores["orders"] {
+		t.Fatalf("Unexpected UI stores: %v", stores)
+	}
+	if !graph.Covered() || !graph.TotalityUnique() {
+		t.Fatal("Single UI graph is not covered and totality unique")
+	}
+	if _, err := graph.AddTotalUI("missing"); err == nil {
+		t.Fatal("Added a UI for an unregistered CDS")
+	}
+}
@@ -0,0 +1,101 @@
+// +build test
+
+package fabric_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/JKhawaja/fabric"
+)
+
+func levelIDs(levels [][]fabric.DGNode) [][]int {
+	var ids [][]int
+	for _, l := range levels {
+		var level []int
+		for _, n := range l {
+			level = append(level, n.ID())
+		}
+		ids = append(ids, level)
+	}
+	return ids
+}
+
+// TestLevels: a diamond (4 depends on 2 and 3, which both depend on 1)
+// has three levels, and a cyclic graph has none
+func TestLevels(t *testing.T) {
+	graph := fabric.NewGraph()
+	for id := 1; id <= 4; id++ {
+		if _, err := graph.AddRealNode(newTestUI(id, false)); err != nil {
+			t.Fatalf("Could not add UI node to graph: %v", err)
+		}
+	}
+	graph.AddRealEdge(4, newTestUI(3, false))
+	graph.AddRealEdge(4, newTestUI(2, false))
+	graph.AddRealEdge(3, newTestUI(1, false))
+	graph.AddRealEdge(2, newTestUI(1, false))
+
+	levels, err := graph.Levels()
+	if err != nil {
+		t.Fatalf("Could not compute levels: %v", err)
+	}
+
+	expected := [][]int{{1}, {2, 3}, {4}}
+	if !reflect.DeepEqual(levelIDs(levels), expected) {
+		t.Fatalf("Expected levels %v, got %v", expected, levelIDs(levels))
+	}
+
+	order, err := graph.TopologicalOrder()
+	if err != nil {
+		t.Fatalf("Could not compute topological order: %v", err)
+	}
+	if !reflect.DeepEqual(levelIDs([][]fabric.DGNode{order}), [][]int{{1, 2, 3, 4}}) {
+		t.Fatalf("Unexpected topological order: %v", order)
+	}
+
+	graph.AddRealEdge(1, newTestUI(4, false))
+	if _, err := graph.Levels(); err == nil {
+		t.Fatal("Computed levels for a cyclic graph")
+	}
+}
+
+func TestVDGLevels(t *testing.T) {
+	graph := fabric.NewGraph()
+	vdg, err := fabric.NewVDG(graph)
+	if err != nil {
+		t.Fatalf("Could not create VDG and add to graph: %v", err)
+	}
+
+	space := newTestUI(1, false)
+	var nodes []Virtual
+	for id := 10; id < 13; id++ {
+		sm := make(fabric.SignalingMap)
+		s := make(fabric.SignalsMap)
+		v := Virtual{
+			Node: Node{
+				Id:        id,
+				Type:      fabric.VDGNode,
+				Signalers: &sm,
+				Signals:   &s,
+			},
+			Space: space,
+		}
+		if _, err := vdg.AddVirtualNode(v); err != nil {
+			t.Fatalf("Could not add Virtual node to VDG: %v", err)
+		}
+		nodes = append(nodes, v)
+	}
+	vdg.AddVirtualEdge(12, nodes[0])
+	vdg.AddVirtualEdge(11, nodes[0])
+
+	levels, err := vdg.Levels()
+	if err != nil {
+		t.Fatalf("Could not compute levels: %v", err)
+	}
+	if len(levels) != 2 || len(levels[0]) != 1 || len(levels[1]) != 2 {
+		t.Fatalf("Unexpected VDG levels: %v", levels)
+	}
+	if levels[1][0].ID() != 11 || levels[1][1].ID() != 12 {
+		t.Fatalf("VDG level is not sorted by id: %v", levels[1])
+	}
+}
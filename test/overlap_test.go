@@ -0,0 +1,83 @@
+// +build test
+
+package fabric_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/JKhawaja/fabric"
+)
+
+// overlapGraph: 1 and 2 share node 3, 2 and 4 share edge 30, 3 is disjoint,
+// VUI 5 shares node 1 with UI 1 but already depends on it, and UI 6 covers the
+// same nodes as UI 1 in another CDS
+func overlapGraph() (*fabric.Graph, []UI) {
+	graph := fabric.NewGraph()
+
+	u1 := newTestUI(1, false)
+	u1.CDS = sectionOf([]int{1, 2, 3}, []int{10, 11})
+	u2 := newTestUI(2, false)
+	u2.CDS = sectionOf([]int{3, 4}, []int{30})
+	u3 := newTestUI(3, false)
+	u3.CDS = sectionOf([]int{7, 8}, []int{12})
+	u4 := newTestUI(4, false)
+	u4.CDS = sectionOf([]int{9}, []int{30})
+	v5 := newTestUI(5, true)
+	v5.CDS = sectionOf([]int{1}, nil)
+	u6 := newTestUI(6, false)
+	u6.CDS = sectionOf([]int{1, 2, 3}, nil)
+	u6.Store = "other"
+
+	uis := []UI{u1, u2, u3, u4, v5, u6}
+	for _, u := range uis {
+		graph.AddRealNode(u)
+	}
+	graph.AddRealEdge(5, u1)
+
+	return graph, uis
+}
+
+func TestOverlaps(t *testing.T) {
+	graph, _ := overlapGraph()
+
+	expected := []fabric.SectionOverlap{
+		{A: 1, B: 2, Nodes: []int{3}},
+		{A: 1, B: 5, Nodes: []int{1}, Ordered: true},
+		{A: 2, B: 4, Edges: []int{30}},
+	}
+	if found := graph.Overlaps(); !reflect.DeepEqual(found, expected) {
+		t.Fatalf("Unexpected overlaps: %+v", found)
+	}
+}
+
+func TestOrderOverlaps(t *testing.T) {
+	graph, uis := overlapGraph()
+	graph.RejectCycles(true)
+
+	ordered, err := graph.OrderOverlaps(fabric.ByPriority)
+	if err != nil {
+		t.Fatalf("Could not order overlaps: %v", err)
+	}
+	if len(ordered) != 2 {
+		t.Fatalf("Unexpected ordered overlaps: %+v", ordered)
+	}
+
+	// on equal priorities the smaller id goes first: 4 waits on 2, which waits on 1
+	for id, dep := range map[int]int{2: 1, 4: 2} {
+		deps := graph.Dependencies(uis[id-1])
+		if len(deps) != 1 || deps[0].ID() != dep {
+			t.Fatalf("UI %d is not ordered after UI %d: %v", id, dep, deps)
+		}
+	}
+	for _, o := range graph.Overlaps() {
+		if !o.Ordered {
+			t.Fatalf("Overlap is still unordered: %+v", o)
+		}
+	}
+
+	// ordering again changes nothing
+	if ordered, _ := graph.OrderOverlaps(fabric.ByPriority); len(ordered) != 0 {
+		t.Fatalf("Ordered overlaps twice: %+v", ordered)
+	}
+}
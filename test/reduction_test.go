@@ -0,0 +1,158 @@
+// +build test
+
+package fabric_test
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/JKhawaja/fabric"
+)
+
+// chainPoset orders every new node after every node already in the graph
+type chainPoset struct {
+	graph *fabric.Graph
+}
+
+func (p *chainPoset) Graph() *fabric.Graph {
+	return p.graph
+}
+
+func (p *chainPoset) InitGraph(nodes []fabric.DGNode) *fabric.Graph {
+	for _, n := range nodes {
+		p.Order(n)
+	}
+	return p.graph
+}
+
+func (p *chainPoset) Order(n fabric.DGNode) error {
+	existing := p.graph.Nodes()
+	if _, err := p.graph.AddRealNode(n); err != nil {
+		return err
+	}
+	for _, e := range existing {
+		if err := p.graph.AddRealEdge(n.ID(), e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func edgeCount(g *fabric.Graph) int {
+	count := 0
+	for _, n := range g.Nodes() {
+		count += len(g.Dependencies(n))
+	}
+	return count
+}
+
+// TestTransitiveReduction: a total order keeps a single edge per node
+func TestTransitiveReduction(t *testing.T) {
+	p := &chainPoset{graph: fabric.NewGraph()}
+	for id := 1; id <= 5; id++ {
+		p.Order(newTestUI(id, false))
+	}
+	levels, _ := p.graph.Levels()
+	if edgeCount(p.graph) != 10 {
+		t.Fatalf("Unexpected number of edges: %d", edgeCount(p.graph))
+	}
+
+	removed, err := p.graph.TransitiveReduction()
+	if err != nil {
+		t.Fatalf("Could not reduce graph: %v", err)
+	}
+	if removed != 6 || edgeCount(p.graph) != 4 {
+		t.Fatalf("Removed %d edges, %d left", removed, edgeCount(p.graph))
+	}
+	reduced, _ := p.graph.Levels()
+	if !reflect.DeepEqual(levelIDs(reduced), levelIDs(levels)) {
+		t.Fatalf("Reduction changed the order: %v", levelIDs(reduced))
+	}
+	n5, _ := p.graph.Node(5)
+	if len(n5.ListSignals()) != 1 {
+		t.Fatalf("Redundant signaling channels were kept: %v", n5.ListSignals())
+	}
+
+	// an executing dependency keeps its edges
+	p = &chainPoset{graph: fabric.NewGraph()}
+	for id := 1; id <= 3; id++ {
+		p.Order(newTestUI(id, false))
+	}
+	p.graph.SetState(1, fabric.Started)
+	if removed, _ := p.graph.TransitiveReduction(); removed != 0 {
+		t.Fatalf("Removed %d edges of an executing dependency", removed)
+	}
+
+	// as does a blocked dependent
+	p.graph.SetState(1, fabric.Completed)
+	p.graph.SetState(3, fabric.Waiting)
+	if removed, _ := p.graph.TransitiveReduction(); removed != 0 {
+		t.Fatalf("Removed %d edges of a blocked dependent", removed)
+	}
+	p.graph.SetState(3, fabric.Started)
+	if removed, _ := p.graph.TransitiveReduction(); removed != 1 {
+		t.Fatalf("Removed %d edges once the dependent stopped blocking", removed)
+	}
+}
+
+// TestReducedPoset: the reduction is applied after every Order()
+func TestReducedPoset(t *testing.T) {
+	p := fabric.Reduced(&chainPoset{graph: fabric.NewGraph()})
+	for id := 1; id <= 6; id++ {
+		if err := p.Order(newTestUI(id, false)); err != nil {
+			t.Fatalf("Could not order node: %v", err)
+		}
+	}
+	if edgeCount(p.Graph()) != 5 {
+		t.Fatalf("Unexpected number of edges: %d", edgeCount(p.Graph()))
+	}
+}
+
+// slowHandler reacts to every signal after a delay, so dependencies block while sending
+type slowHandler struct {
+	*fabric.Policy
+}
+
+func (h slowHandler) React(dependency int, s fabric.NodeSignal, retries int) fabric.Reaction {
+	time.Sleep(5 * time.Millisecond)
+	return h.Policy.React(dependency, s, retries)
+}
+
+// TestReductionDuringExecution: an edge is not retired while its dependency
+// is still sending on it
+func TestReductionDuringExecution(t *testing.T) {
+	for i := 0; i < 20; i++ {
+		graph := (&chainPoset{fabric.NewGraph()}).InitGraph([]fabric.DGNode{
+			newTestUI(1, false), newTestUI(2, false), newTestUI(3, false),
+		})
+		e := fabric.NewExecutor(graph)
+		e.Handler = slowHandler{fabric.CompletionPolicy()}
+		e.Default = func(fabric.DGNode) error { return nil }
+
+		done := make(chan error)
+		go func() {
+			_, err := e.Run()
+			done <- err
+		}()
+
+		// reduce as soon as node 1 counts as completed, while it may still be
+		// sending Completed on the redundant edge 3 -> 1
+		for {
+			if s, _ := graph.State(1); s == fabric.Completed {
+				break
+			}
+			time.Sleep(10 * time.Microsecond)
+		}
+		removed, err := graph.TransitiveReduction()
+		if err != nil {
+			t.Fatalf("Could not reduce graph: %v", err)
+		}
+		if err := <-done; err != nil {
+			t.Fatalf("Could not run graph: %v", err)
+		}
+		if n, _ := graph.TransitiveReduction(); removed+n != 1 {
+			t.Fatalf("Unexpected number of removed edges: %d", removed+n)
+		}
+	}
+}
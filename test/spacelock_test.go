@@ -0,0 +1,179 @@
+// +build test
+
+package fabric_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/JKhawaja/fabric"
+)
+
+// spaceNode creates a virtual node on the given space with an access procedure of the given class
+func spaceNode(id int, space fabric.UI, class fabric.AccessClass) Virtual {
+	sm := make(fabric.SignalingMap)
+	s := make(fabric.SignalsMap)
+	p := fabric.ProcedureList{ClassedProcedure{Procedure{Id: id}, class}}
+	return Virtual{
+		Node:  Node{Id: id, Type: fabric.VDGNode, Signalers: &sm, Signals: &s, AccessProcedures: &p},
+		Space: space,
+	}
+}
+
+// lockAsync locks the space of a node on a goroutine
+func lockAsync(l *fabric.SpaceLock, n fabric.DGNode) <-chan func() {
+	c := make(chan func(), 1)
+	go func() {
+		release, err := l.Lock(context.Background(), n)
+		if err == nil {
+			c <- release
+		}
+	}()
+	return c
+}
+
+func granted(c <-chan func()) (func(), bool) {
+	select {
+	case release := <-c:
+		return release, true
+	case <-time.After(20 * time.Millisecond):
+		return nil, false
+	}
+}
+
+func TestSpaceLock(t *testing.T) {
+	space := newTestUI(1, true)
+	r1, r2, r3 := spaceNode(11, space, fabric.ReadClass), spaceNode(12, space, fabric.ReadClass), spaceNode(13, space, fabric.ReadClass)
+	w := spaceNode(14, space, fabric.WriteClass)
+
+	for _, policy := range []fabric.RWPolicy{fabric.WriterPreference, fabric.ReaderPreference, fabric.FIFO} {
+		l := fabric.NewSpaceLock(policy)
+
+		// readers share the space
+		release1, _ := l.Lock(context.Background(), r1)
+		release2, _ := l.Lock(context.Background(), r2)
+		if readers, writer := l.Holders(1); readers != 2 || writer {
+			t.Fatalf("Policy %d: unexpected holders: %d readers, writer %v", policy, readers, writer)
+		}
+
+		// the writer waits for the readers in flight
+		wc := lockAsync(l, w)
+		if _, ok := granted(wc); ok {
+			t.Fatalf("Policy %d: writer acquired the space with readers in flight", policy)
+		}
+
+		// only readers that are not preferred over the waiting writer join
+		rc := lockAsync(l, r3)
+		release3, joined := granted(rc)
+		if joined != (policy == fabric.ReaderPreference) {
+			t.Fatalf("Policy %d: new reader joined: %v", policy, joined)
+		}
+
+		release1()
+		release2()
+		if joined {
+			release3()
+		}
+		releaseW, ok := granted(wc)
+		if !ok {
+			t.Fatalf("Policy %d: writer did not acquire the space", policy)
+		}
+		if readers, writer := l.Holders(1); readers != 0 || !writer {
+			t.Fatalf("Policy %d: unexpected holders: %d readers, writer %v", policy, readers, writer)
+		}
+
+		releaseW()
+		if !joined {
+			if release3, ok = granted(rc); !ok {
+				t.Fatalf("Policy %d: reader did not acquire the space after the writer", policy)
+			}
+			release3()
+		}
+		if readers, writer := l.Holders(1); readers != 0 || writer {
+			t.Fatalf("Policy %d: space is still held: %d readers, writer %v", policy, readers, writer)
+		}
+	}
+}
+
+func TestSpaceLockContext(t *testing.T) {
+	space := newTestUI(1, true)
+	l := fabric.NewSpaceLock(fabric.WriterPreference)
+	release, _ := l.Lock(context.Background(), spaceNode(11, space, fabric.ReadClass))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err := l.Lock(ctx, spaceNode(12, space, fabric.WriteClass))
+	if _, ok := err.(*fabric.BlockError); !ok {
+		t.Fatalf("Expected a *BlockError, got %v", err)
+	}
+
+	// the writer that gave up no longer keeps readers out
+	if _, ok := granted(lockAsync(l, spaceNode(13, space, fabric.ReadClass))); !ok {
+		t.Fatal("Reader is kept out by a writer that gave up")
+	}
+	release()
+}
+
+func TestSpaceLockReleaseTwice(t *testing.T) {
+	space := newTestUI(1, true)
+	l := fabric.NewSpaceLock(fabric.WriterPreference)
+	release1, _ := l.Lock(context.Background(), spaceNode(11, space, fabric.ReadClass))
+	release2, _ := l.Lock(context.Background(), spaceNode(12, space, fabric.ReadClass))
+
+	// a second call must not release the space of the other reader
+	release1()
+	release1()
+	if readers, writer := l.Holders(1); readers != 1 || writer {
+		t.Fatalf("Unexpected holders after releasing twice: %d readers, writer %v", readers, writer)
+	}
+	if _, ok := granted(lockAsync(l, spaceNode(13, space, fabric.WriteClass))); ok {
+		t.Fatal("Writer got the space while a reader holds it")
+	}
+
+	release2()
+	release2()
+	if readers, writer := l.Holders(1); readers != 0 || !writer {
+		t.Fatalf("Unexpected holders: %d readers, writer %v", readers, writer)
+	}
+}
+
+// TestExecutorSpaceLock: readers run their functions at the same time, writers alone
+func TestExecutorSpaceLock(t *testing.T) {
+	graph := fabric.NewGraph()
+	space := newTestUI(1, true)
+	vdg, _ := fabric.NewVDG(graph)
+	e := fabric.NewVDGExecutor(vdg)
+	e.Locks = fabric.NewSpaceLock(fabric.WriterPreference)
+
+	both := make(chan struct{})
+	reader := func(fabric.DGNode) error {
+		both <- struct{}{}
+		return nil
+	}
+	done := make(chan error, 2)
+	go func() { done <- e.RunNode(spaceNode(11, space, fabric.ReadClass), reader) }()
+	go func() {
+		done <- e.RunNode(spaceNode(12, space, fabric.ReadClass), func(fabric.DGNode) error { <-both; return nil })
+	}()
+	for i := 0; i < 2; i++ {
+		select {
+		case err := <-done:
+			if err != nil {
+				t.Fatalf("Reader failed: %v", err)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("Readers did not run at the same time")
+		}
+	}
+
+	err := e.RunNode(spaceNode(13, space, fabric.WriteClass), func(fabric.DGNode) error {
+		if readers, writer := e.Locks.Holders(1); readers != 0 || !writer {
+			t.Errorf("Writer does not hold the space alone: %d readers, writer %v", readers, writer)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Writer failed: %v", err)
+	}
+}
@@ -0,0 +1,229 @@
+// +build test
+
+package fabric_test
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/JKhawaja/fabric"
+)
+
+// branches builds the diamond graph, where 2 and 3 are branches over a cell each
+func branches(t *testing.T, cells map[int]*Cell, procedures map[int]fabric.ProcedureList) (*fabric.Graph, map[int]UI) {
+	graph := fabric.NewGraph()
+	nodes := make(map[int]UI)
+	for id := 1; id <= 4; id++ {
+		u := newTestUI(id, false)
+		if c, ok := cells[id-1]; ok {
+			u.CDS = cellSection(map[int]*Cell{1: c})
+		}
+		*u.AccessProcedures = procedures[id]
+		if _, err := graph.AddRealNode(u); err != nil {
+			t.Fatalf("Could not add UI node to graph: %v", err)
+		}
+		nodes[id] = u
+	}
+	graph.AddRealEdge(4, nodes[3])
+	graph.AddRealEdge(4, nodes[2])
+	graph.AddRealEdge(3, nodes[1])
+	graph.AddRealEdge(2, nodes[1])
+	graph.SignalsAndSignalers()
+
+	return graph, nodes
+}
+
+// received collects every signal a node receives, per dependency
+func received(n UI) func() map[int][]fabric.Signal {
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	signals := make(map[int][]fabric.Signal)
+	for id, c := range n.ListSignals() {
+		wg.Add(1)
+		go func(id int, c <-chan fabric.NodeSignal) {
+			defer wg.Done()
+			for s := range c {
+				mu.Lock()
+				signals[id] = append(signals[id], s.Value)
+				mu.Unlock()
+				if s.Value == fabric.Completed || s.Value == fabric.Aborted {
+					return
+				}
+			}
+		}(id, c)
+	}
+
+	return func() map[int][]fabric.Signal {
+		wg.Wait()
+		return signals
+	}
+}
+
+// TestTransaction: a move between two branches commits both, and signals dependents once
+func TestTransaction(t *testing.T) {
+	cells := map[int]*Cell{1: {Id: 1, Value: 7}, 2: {Id: 1, Value: 0}}
+	remove := SetCell{Procedure: Procedure{Id: 1}, Cells: map[int]*Cell{1: cells[1]}, Target: 1}
+	mark := SetCell{Procedure: Procedure{Id: 2}, Cells: map[int]*Cell{1: cells[1]}, Target: 1}
+	insert := SetCell{Procedure: Procedure{Id: 3}, Cells: map[int]*Cell{1: cells[2]}, Target: 1}
+	graph, nodes := branches(t, cells, map[int]fabric.ProcedureList{2: {remove, mark}, 3: {insert}})
+
+	tx := fabric.NewTransaction(graph)
+	tx.Locks = fabric.NewSpaceLock(fabric.WriterPreference)
+	tx.Add(nodes[3], insert, func() error { cells[2].Value = cells[1].Value; return nil })
+	tx.Add(nodes[2], remove, func() error { cells[1].Value = 0; return nil })
+	tx.Add(nodes[2], mark, func() error { cells[1].Value = -1; return nil })
+
+	order, err := tx.Nodes()
+	if err != nil || len(order) != 2 || order[0].ID() != 2 || order[1].ID() != 3 {
+		t.Fatalf("Unexpected acquisition order: %v %v", order, err)
+	}
+
+	wait := received(nodes[4])
+	go nodes[1].Signal(fabric.NodeSignal{Value: fabric.Completed})
+	if err := tx.Run(); err != nil {
+		t.Fatalf("Could not run transaction: %v", err)
+	}
+	if cells[1].Value != -1 || cells[2].Value != 7 {
+		t.Fatalf("Unexpected values after commit: %d %d", cells[1].Value, cells[2].Value)
+	}
+	expected := map[int][]fabric.Signal{2: {fabric.Completed}, 3: {fabric.Completed}}
+	if signals := wait(); !reflect.DeepEqual(signals, expected) {
+		t.Fatalf("Unexpected signals: %v", signals)
+	}
+	if s, _ := graph.State(2); s != fabric.Completed {
+		t.Fatalf("Unexpected state of a committed node: %v", s)
+	}
+}
+
+// TestTransactionRollback: a failing step rolls back every step of the transaction
+func TestTransactionRollback(t *testing.T) {
+	cells := map[int]*Cell{1: {Id: 1, Value: 7}, 2: {Id: 1, Value: 0}}
+	remove := SetCell{Procedure: Procedure{Id: 1}, Cells: map[int]*Cell{1: cells[1]}, Target: 1}
+	insert := SetCell{Procedure: Procedure{Id: 3}, Cells: map[int]*Cell{1: cells[2]}, Target: 1}
+	graph, nodes := branches(t, cells, map[int]fabric.ProcedureList{2: {remove}, 3: {insert}})
+
+	failure := errors.New("failed")
+	tx := fabric.NewTransaction(graph)
+	tx.Add(nodes[2], remove, func() error { cells[1].Value = 0; return nil })
+	tx.Add(nodes[3], insert, func() error { cells[2].Value = 7; return failure })
+
+	wait := received(nodes[4])
+	go nodes[1].Signal(fabric.NodeSignal{Value: fabric.Completed})
+	if err := tx.Run(); err != failure {
+		t.Fatalf("Expected the error of the failed step, got %v", err)
+	}
+	if cells[1].Value != 7 || cells[2].Value != 0 {
+		t.Fatalf("Unexpected values after rollback: %d %d", cells[1].Value, cells[2].Value)
+	}
+	expected := map[int][]fabric.Signal{2: {fabric.Aborted}, 3: {fabric.Aborted}}
+	if signals := wait(); !reflect.DeepEqual(signals, expected) {
+		t.Fatalf("Unexpected signals: %v", signals)
+	}
+}
+
+// TestTransactionInvalid: steps must be procedures of their node, and no
+// node outside the transaction may lie between two of its nodes
+func TestTransactionInvalid(t *testing.T) {
+	remove := SetCell{Procedure: Procedure{Id: 1}, Target: 1}
+	graph, nodes := branches(t, nil, map[int]fabric.ProcedureList{1: {remove}, 4: {remove}})
+
+	tx := fabric.NewTransaction(graph)
+	if err, ok := tx.Add(nodes[2], remove, nil).(*fabric.PermissionError); !ok || err.Node != 2 {
+		t.Fatalf("Expected a *PermissionError, got %v", err)
+	}
+
+	tx.Add(nodes[1], remove, func() error { return nil })
+	tx.Add(nodes[4], remove, func() error { return nil })
+	if _, err := tx.Nodes(); err == nil {
+		t.Fatal("Transaction enclosing node outside of it was accepted")
+	}
+}
+
+// TestTransactionLockOrder: transactions lock shared spaces in the same order,
+// whichever of their nodes operate on them
+func TestTransactionLockOrder(t *testing.T) {
+	a, b := newTestUI(1, false), newTestUI(2, false)
+	graph := fabric.NewGraph()
+	locks := fabric.NewSpaceLock(fabric.WriterPreference)
+	transaction := func(nodes ...Virtual) *fabric.Transaction {
+		tx := fabric.NewTransaction(graph)
+		tx.Locks = locks
+		for _, n := range nodes {
+			graph.AddRealNode(n)
+			tx.Add(n, n.ListProcedures()[0], func() error { return nil })
+		}
+		return tx
+	}
+	// tx1 reaches space a through its first node, tx2 through its second
+	tx1 := transaction(spaceNode(3, a, fabric.WriteClass), spaceNode(4, b, fabric.WriteClass))
+	tx2 := transaction(spaceNode(5, b, fabric.WriteClass), spaceNode(6, a, fabric.WriteClass))
+
+	// hold a, so that both transactions queue up behind it
+	release, err := locks.Lock(context.Background(), spaceNode(7, a, fabric.WriteClass))
+	if err != nil {
+		t.Fatalf("Could not lock space: %v", err)
+	}
+	done := make(chan error, 2)
+	go func() { done <- tx1.Run() }()
+	time.Sleep(20 * time.Millisecond)
+	go func() { done <- tx2.Run() }()
+	time.Sleep(20 * time.Millisecond)
+	release()
+
+	for i := 0; i < 2; i++ {
+		select {
+		case err := <-done:
+			if err != nil {
+				t.Fatalf("Could not run transaction: %v", err)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatal("Transactions locked each other out")
+		}
+	}
+}
+
+// TestTransactionDependencyLockOrder: spaces are locked after the spaces they depend on
+func TestTransactionDependencyLockOrder(t *testing.T) {
+	a, b := newTestUI(1, false), newTestUI(2, false)
+	graph := fabric.NewGraph()
+	graph.AddRealNode(a)
+	graph.AddRealNode(b)
+	// space a depends on space b, so b is locked first despite its higher id
+	if err := graph.AddRealEdge(1, b); err != nil {
+		t.Fatalf("Could not add edge: %v", err)
+	}
+
+	locks := fabric.NewSpaceLock(fabric.WriterPreference)
+	tx := fabric.NewTransaction(graph)
+	tx.Locks = locks
+	for _, n := range []Virtual{spaceNode(3, a, fabric.WriteClass), spaceNode(4, b, fabric.WriteClass)} {
+		graph.AddRealNode(n)
+		tx.Add(n, n.ListProcedures()[0], func() error { return nil })
+	}
+
+	// hold b: the transaction must not hold a while it waits for b
+	release, err := locks.Lock(context.Background(), spaceNode(5, b, fabric.WriteClass))
+	if err != nil {
+		t.Fatalf("Could not lock space: %v", err)
+	}
+	done := make(chan error, 1)
+	go func() { done <- tx.Run() }()
+	time.Sleep(20 * time.Millisecond)
+	if _, writer := locks.Holders(1); writer {
+		t.Fatal("Space a was locked before the space it depends on")
+	}
+	release()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("Could not run transaction: %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Transaction did not run")
+	}
+}
@@ -0,0 +1,177 @@
+// +build test
+
+package fabric_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/JKhawaja/fabric"
+)
+
+// Cell is a mutable CDS node that snapshots itself by value
+type Cell struct {
+	Id    int
+	Value int
+}
+
+func (c *Cell) ID() int {
+	return c.Id
+}
+
+func (c *Cell) Immutable() bool {
+	return false
+}
+
+func (c *Cell) Snapshot() fabric.Node {
+	copy := *c
+	return &copy
+}
+
+// SetCell is a test access type that writes a single cell, and restores the cells it is given on rollback
+type SetCell struct {
+	Procedure
+	Cells  map[int]*Cell
+	Target int
+	Fail   bool
+}
+
+func (s SetCell) InvariantNode(n fabric.Node) bool {
+	return n.ID() != s.Target
+}
+
+func (s SetCell) InvariantEdge(fabric.Edge) bool {
+	return true
+}
+
+func (s SetCell) Rollback(nodes fabric.RestoreNodes, edges fabric.RestoreEdges) error {
+	if s.Fail {
+		return errors.New("rollback failed")
+	}
+	for _, n := range nodes {
+		*s.Cells[n.ID()] = *n.(*Cell)
+	}
+	return nil
+}
+
+// Ref is a mutable CDS node that cannot snapshot itself
+type Ref struct {
+	Id    int
+	Value int
+}
+
+func (r *Ref) ID() int {
+	return r.Id
+}
+
+func (r *Ref) Immutable() bool {
+	return false
+}
+
+func cellSection(cells map[int]*Cell) fabric.Section {
+	nodes := make(fabric.NodeList, 0)
+	for id := 1; id <= len(cells); id++ {
+		nodes = append(nodes, cells[id])
+	}
+	edges := make(fabric.EdgeList, 0)
+	return fabric.NewDisjoint(&nodes, &edges)
+}
+
+func TestUndoLog(t *testing.T) {
+	cells := map[int]*Cell{1: {Id: 1, Value: 1}, 2: {Id: 2, Value: 2}}
+	section := cellSection(cells)
+
+	log := fabric.NewUndoLog()
+	log.Record(SetCell{Procedure: Procedure{Id: 1}, Cells: cells, Target: 1}, section)
+	log.Record(SetCell{Procedure: Procedure{Id: 2}, Cells: cells, Target: 1}, section)
+	cells[1].Value = 10
+	cells[2].Value = 20
+
+	if err := log.Rollback(); err != nil {
+		t.Fatalf("Could not roll back: %v", err)
+	}
+	// only the write set is restored
+	if cells[1].Value != 1 || cells[2].Value != 20 {
+		t.Fatalf("Unexpected values after rollback: %d %d", cells[1].Value, cells[2].Value)
+	}
+	if log.Len() != 0 {
+		t.Fatal("Log was not emptied by the rollback")
+	}
+
+	log.Record(SetCell{Procedure: Procedure{Id: 1}, Cells: cells, Target: 1}, section)
+	log.Commit()
+	cells[1].Value = 10
+	log.Rollback()
+	if cells[1].Value != 10 {
+		t.Fatal("Committed procedure was rolled back")
+	}
+}
+
+func TestExecutorUndo(t *testing.T) {
+	cells := map[int]*Cell{1: {Id: 1, Value: 1}}
+	graph := fabric.NewGraph()
+	e := fabric.NewExecutor(graph)
+	e.Undo = true
+
+	u := newTestUI(1, false)
+	u.CDS = cellSection(cells)
+	*u.AccessProcedures = fabric.ProcedureList{SetCell{Procedure: Procedure{Id: 1}, Cells: cells, Target: 1}}
+	graph.AddRealNode(u)
+
+	failure := errors.New("failed")
+	err := e.RunNode(u, func(fabric.DGNode) error {
+		cells[1].Value = 10
+		return failure
+	})
+	if err != failure || cells[1].Value != 1 {
+		t.Fatalf("Failed node was not rolled back: %v, value %d", err, cells[1].Value)
+	}
+
+	// a successful node is not rolled back
+	if err := e.RunNode(u, func(fabric.DGNode) error { cells[1].Value = 10; return nil }); err != nil || cells[1].Value != 10 {
+		t.Fatalf("Successful node was rolled back: %v, value %d", err, cells[1].Value)
+	}
+
+	*u.AccessProcedures = fabric.ProcedureList{SetCell{Procedure: Procedure{Id: 1}, Cells: cells, Target: 1, Fail: true}}
+	err = e.RunNode(u, func(fabric.DGNode) error { return failure })
+	if rerr, ok := err.(*fabric.RollbackError); !ok || rerr.Err != failure || rerr.Node != 1 {
+		t.Fatalf("Expected a *RollbackError, got %v", err)
+	}
+}
+
+func TestUndoLogPointerNode(t *testing.T) {
+	cells := map[int]*Cell{1: {Id: 1, Value: 1}}
+	ref := &Ref{Id: 2, Value: 2}
+	nodes := fabric.NodeList{cells[1], ref}
+	edges := make(fabric.EdgeList, 0)
+	section := fabric.NewDisjoint(&nodes, &edges)
+
+	// a pointer node that cannot be snapshotted would be "restored" to its mutated self
+	log := fabric.NewUndoLog()
+	if err := log.Record(SetCell{Procedure: Procedure{Id: 1}, Cells: cells, Target: 2}, section); err == nil {
+		t.Fatal("Recorded a pointer node that cannot be snapshotted")
+	}
+	if log.Len() != 0 {
+		t.Fatal("Recorded a procedure whose write set cannot be snapshotted")
+	}
+	if err := log.Record(SetCell{Procedure: Procedure{Id: 1}, Cells: cells, Target: 1}, section); err != nil {
+		t.Fatalf("Could not record a write set of snapshotters: %v", err)
+	}
+
+	// the executor does not run a node it could not roll back
+	graph := fabric.NewGraph()
+	e := fabric.NewExecutor(graph)
+	e.Undo = true
+	u := newTestUI(1, false)
+	u.CDS = section
+	*u.AccessProcedures = fabric.ProcedureList{SetCell{Procedure: Procedure{Id: 1}, Cells: cells, Target: 2}}
+	graph.AddRealNode(u)
+
+	ran := false
+	if err := e.RunNode(u, func(fabric.DGNode) error { ran = true; return nil }); err == nil || ran {
+		t.Fatalf("Ran a node whose write set cannot be snapshotted: %v", err)
+	}
+	if state, _ := graph.State(1); state != fabric.Aborted {
+		t.Fatalf("Unexpected state of the node: %v", state)
+	}
+}
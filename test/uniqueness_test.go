@@ -0,0 +1,48 @@
+// +build test
+
+package fabric_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/JKhawaja/fabric"
+)
+
+func TestVerifyUniqueness(t *testing.T) {
+	graph := fabric.NewGraph()
+
+	// 1 and 2 address the same section; 3 is strictly unique but shares edge 20
+	// with 4; VUI 5 addresses the same section as 1 and 2
+	u1 := newTestUI(1, false)
+	u1.CDS = sectionOf([]int{1, 2}, []int{10})
+	u2 := newTestUI(2, false)
+	u2.CDS = sectionOf([]int{2, 1}, []int{10})
+	u3 := newTestUI(3, false)
+	u3.CDS = sectionOf([]int{3}, []int{20})
+	u3.Unique = true
+	u4 := newTestUI(4, false)
+	u4.CDS = sectionOf([]int{4}, []int{20})
+	v5 := newTestUI(5, true)
+	v5.CDS = sectionOf([]int{1, 2}, []int{10})
+	for _, u := range []UI{u1, u2, u3, u4, v5} {
+		graph.AddRealNode(u)
+	}
+
+	expected := []fabric.UniquenessConflict{
+		{A: 1, B: 2, Violation: fabric.TotalityViolation, Nodes: []int{1, 2}, Edges: []int{10}},
+		{A: 3, B: 4, Violation: fabric.StrictViolation, Edges: []int{20}},
+	}
+	if found := graph.VerifyUniqueness(); !reflect.DeepEqual(found, expected) {
+		t.Fatalf("Unexpected conflicts: %+v", found)
+	}
+	if graph.TotalityUnique() || graph.StrictlyUnique() {
+		t.Fatal("Incorrectly classified graph as unique")
+	}
+
+	graph.RemoveRealNode(u2)
+	graph.RemoveRealNode(u4)
+	if !graph.TotalityUnique() || !graph.StrictlyUnique() {
+		t.Fatalf("Unexpected conflicts: %+v", graph.VerifyUniqueness())
+	}
+}
@@ -171,7 +171,11 @@ func TestVDG(t *testing.T) {
 		}
 	}
 
-	// Remove the second virtual node
+	// Remove the second virtual node (once its dependent is no longer waiting on it)
+	if err := vdg.RemoveVirtualNode(vp2); err == nil {
+		t.Fatal("Removed a virtual node that a dependent may be waiting on")
+	}
+	vdg.SetState(v.Id, fabric.Completed)
 	err = vdg.RemoveVirtualNode(vp2)
 	if err != nil {
 		t.Fatalf("Could not remove second Virtual node from VDG: %v", err)
@@ -201,3 +205,51 @@ func TestVDG(t *testing.T) {
 		}
 	}
 }
+
+// TestAddTopNode: top nodes only become dependencies of the root once it is a node of the VDG
+func TestAddTopNode(t *testing.T) {
+	graph := fabric.NewGraph()
+	vdg, err := fabric.NewVDGWithRoot(graph)
+	if err != nil {
+		t.Fatalf("Could not create VDG and add to graph: %v", err)
+	}
+	space := newTestUI(1, false)
+	top := func(id int) Virtual {
+		sm := make(fabric.SignalingMap)
+		s := make(fabric.SignalsMap)
+		return Virtual{
+			Node: Node{
+				Id:        id,
+				Type:      fabric.VDGNode,
+				Signalers: &sm,
+				Signals:   &s,
+			},
+			Space: space,
+		}
+	}
+
+	if err := vdg.AddTopNode(top(1)); err != nil {
+		t.Fatalf("Could not add top node: %v", err)
+	}
+	if deps := vdg.Dependents(top(1)); len(deps) != 0 {
+		t.Fatalf("Top node has dependents without a root node: %v", deps)
+	}
+
+	if _, err := vdg.AddVirtualNode(vdg.Root); err != nil {
+		t.Fatalf("Could not add root node: %v", err)
+	}
+	if err := vdg.AddTopNode(top(2)); err != nil {
+		t.Fatalf("Could not add top node: %v", err)
+	}
+	if deps := vdg.Dependents(top(2)); len(deps) != 1 || deps[0].ID() != vdg.Root.ID() {
+		t.Fatalf("Top node is not a dependency of the root node: %v", deps)
+	}
+
+	vdg.Root.Start()
+	if err := vdg.AddTopNode(top(3)); err == nil {
+		t.Fatal("Added a top node to a root node that has started")
+	}
+	if _, ok := vdg.Node(3); ok {
+		t.Fatal("Top node was added although its edge was refused")
+	}
+}
@@ -0,0 +1,131 @@
+// +build test
+
+package fabric_test
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/JKhawaja/fabric"
+)
+
+func chainIDs(r fabric.WatchdogReport) []int {
+	ids := make([]int, len(r.Chain))
+	for i, n := range r.Chain {
+		ids[i] = n.ID
+	}
+	return ids
+}
+
+// waitFor polls the watchdog until the given nodes are waiting
+func waitFor(t *testing.T, w *fabric.Watchdog, ids []int) {
+	deadline := time.Now().Add(time.Second)
+	for !reflect.DeepEqual(w.Waiting(), ids) {
+		if time.Now().After(deadline) {
+			t.Fatalf("Nodes are not waiting: %v", w.Waiting())
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// TestWatchdogDeadlock: two nodes waiting on each other are reported once
+func TestWatchdogDeadlock(t *testing.T) {
+	graph := fabric.NewGraph()
+	u1, u2 := newTestUI(1, false), newTestUI(2, false)
+	graph.AddRealNode(u1)
+	graph.AddRealNode(u2)
+	graph.AddRealEdge(1, u2)
+	graph.AddRealEdge(2, u1)
+
+	var mu sync.Mutex
+	var reports []fabric.WatchdogReport
+	w := fabric.NewWatchdog(0, func(r fabric.WatchdogReport) {
+		mu.Lock()
+		reports = append(reports, r)
+		mu.Unlock()
+	})
+	graph.SetWatchdog(w)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	for _, id := range []int{1, 2} {
+		wg.Add(1)
+		go func(id int) {
+			defer wg.Done()
+			graph.BlockContext(ctx, id, fabric.CompletionPolicy())
+		}(id)
+	}
+	waitFor(t, w, []int{1, 2})
+
+	found := w.Check()
+	if len(found) != 1 || found[0].Event != fabric.Deadlock {
+		t.Fatalf("Deadlock was not detected: %v", found)
+	}
+	if ids := chainIDs(found[0]); len(ids) != 2 || ids[0] == ids[1] {
+		t.Fatalf("Unexpected deadlock chain: %v", ids)
+	}
+	w.Check()
+	mu.Lock()
+	if len(reports) != 1 {
+		t.Fatalf("Deadlock was reported %d times", len(reports))
+	}
+	mu.Unlock()
+
+	cancel()
+	wg.Wait()
+	if waiting := w.Waiting(); len(waiting) != 0 {
+		t.Fatalf("Nodes are still tracked after unblocking: %v", waiting)
+	}
+}
+
+// TestWatchdogStall: the chain of a stalled node ends at the dependency that is not waiting
+func TestWatchdogStall(t *testing.T) {
+	graph := fabric.NewGraph()
+	u1, u2, u3 := newTestUI(1, false), newTestUI(2, false), newTestUI(3, false)
+	u2.Type = fabric.VUINode
+	graph.AddRealNode(u1)
+	graph.AddRealNode(u2)
+	graph.AddRealNode(u3)
+	graph.AddRealEdge(1, u2)
+	graph.AddRealEdge(3, u1)
+
+	w := fabric.NewWatchdog(10*time.Millisecond, nil)
+	graph.SetWatchdog(w)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	for _, id := range []int{1, 3} {
+		wg.Add(1)
+		go func(id int) {
+			defer wg.Done()
+			graph.BlockContext(ctx, id, fabric.CompletionPolicy())
+		}(id)
+	}
+	waitFor(t, w, []int{1, 3})
+
+	if found := w.Check(); len(found) != 0 {
+		t.Fatalf("Reported a stall before the threshold: %v", found)
+	}
+	time.Sleep(20 * time.Millisecond)
+
+	found := w.Check()
+	if len(found) != 2 {
+		t.Fatalf("Unexpected reports: %v", found)
+	}
+	if found[0].Event != fabric.Stall || !reflect.DeepEqual(chainIDs(found[0]), []int{1, 2}) {
+		t.Fatalf("Unexpected stall of node 1: %v", found[0])
+	}
+	if !reflect.DeepEqual(chainIDs(found[1]), []int{3, 1, 2}) {
+		t.Fatalf("Unexpected stall of node 3: %v", found[1])
+	}
+	culprit := found[1].Chain[2]
+	if culprit.Waiting || culprit.Type != fabric.VUINode {
+		t.Fatalf("Unexpected culprit: %+v", culprit)
+	}
+
+	cancel()
+	wg.Wait()
+}
@@ -0,0 +1,389 @@
+package fabric
+
+import (
+	"context"
+	"fmt"
+	"sort"
+)
+
+/*
+	Transactions
+
+	A DGNode carries a list of access procedures, but some operations need
+	several procedures across more than one (V)UI to succeed or fail
+	together, e.g. moving a subtree from one user's branch to another's
+	(a delete in one UI, an insert in the other).
+
+	A Transaction is a sequence of steps: an access procedure, the node it
+	runs on behalf of, and a closure that makes the call. Run:
+
+		1. acquires the nodes of the steps: each node blocks on its
+		   dependencies outside the transaction, then (if Locks is set) the
+		   spaces of the nodes are locked in dependency-graph order (every
+		   space after the spaces it depends on, ties broken by id), the
+		   same order for every transaction, so that two transactions
+		   sharing a SpaceLock cannot lock each other out
+		2. records an UndoLog and runs the steps in sequence
+		3. if every step succeeded, calls Commit for every step; otherwise
+		   (or if a Commit fails) rolls every step back with Rollback
+		4. signals each node's dependents once: Completed after a commit,
+		   Aborted after a rollback
+
+	Commit is called with a node whose Signal does nothing, so that a node
+	with several steps does not signal its dependents once per step; no
+	Started signal is sent either, and dependents cannot observe a
+	transaction that is later rolled back.
+
+	Every node outside the transaction that depends on one of its nodes
+	waits for the whole transaction, so a node outside it may not lie
+	between two of its nodes (Nodes returns an error).
+
+	Steps are checked against the node's access procedures (see Guard):
+	Add returns a *PermissionError for a procedure the node does not list.
+*/
+
+type txStep struct {
+	node      DGNode
+	procedure AccessType
+	call      func() error
+}
+
+// Transaction runs access procedures across several nodes atomically
+type Transaction struct {
+	Handler SignalHandler // how nodes react to their dependencies' signals (defaults to CompletionPolicy)
+	Locks   *SpaceLock    // locks the space of every node while the transaction runs, in dependency order (optional)
+
+	source executable
+	steps  []txStep
+}
+
+// NewTransaction returns a Transaction over the nodes of a Graph
+func NewTransaction(g *Graph) *Transaction {
+	return &Transaction{source: g}
+}
+
+// NewVDGTransaction returns a Transaction over the nodes of a VDG
+func NewVDGTransaction(v *VDG) *Transaction {
+	return &Transaction{source: v}
+}
+
+// Add appends a step to the transaction: call invokes the access procedure
+// on behalf of the node. Returns a *PermissionError if the node does not list the procedure.
+// NOTE: steps should not be added while the transaction runs
+func (t *Transaction) Add(node DGNode, procedure AccessType, call func() error) error {
+	if !allowed(node, procedure) {
+		return &PermissionError{Node: node.ID(), AccessType: procedure.ID()}
+	}
+	t.steps = append(t.steps, txStep{node: node, procedure: procedure, call: call})
+
+	return nil
+}
+
+// Nodes returns the nodes of the transaction in execution order (every node
+// after its dependencies); the spaces of the nodes are locked in another
+// order (see lockOrder)
+func (t *Transaction) Nodes() ([]DGNode, error) {
+	order, err := t.source.executionOrder()
+	if err != nil {
+		return nil, err
+	}
+	position := make(map[int]int, len(order))
+	for i, n := range order {
+		position[n.ID()] = i
+	}
+
+	seen := make(map[int]bool)
+	var nodes []DGNode
+	for _, s := range t.steps {
+		id := s.node.ID()
+		if seen[id] {
+			continue
+		}
+		if _, ok := position[id]; !ok {
+			return nil, fmt.Errorf("Node %d is not in the graph.", id)
+		}
+		seen[id] = true
+		nodes = append(nodes, s.node)
+	}
+	sort.SliceStable(nodes, func(i, j int) bool {
+		return position[nodes[i].ID()] < position[nodes[j].ID()]
+	})
+
+	return nodes, t.enclosed(nodes, seen)
+}
+
+// enclosed returns an error if a node outside the transaction depends on a
+// node of the transaction and is a dependency of another one: it would wait
+// for the transaction to be over, and the transaction for it
+func (t *Transaction) enclosed(nodes []DGNode, members map[int]bool) error {
+	for _, n := range nodes {
+		visited := make(map[int]bool)
+		var stack []int
+		for id := range n.ListSignals() {
+			if !members[id] {
+				stack = append(stack, id)
+			}
+		}
+		for len(stack) > 0 {
+			id := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			if visited[id] {
+				continue
+			}
+			visited[id] = true
+
+			d, ok := t.source.lookup(id)
+			if !ok {
+				continue
+			}
+			for dep := range d.ListSignals() {
+				if members[dep] {
+					return fmt.Errorf("Node %d depends on node %d of the transaction through node %d outside of it.", n.ID(), dep, id)
+				}
+				stack = append(stack, dep)
+			}
+		}
+	}
+	return nil
+}
+
+// Run executes the transaction; returns the error of the first failed step
+// (or Commit), or the error that kept a node from being acquired.
+// If rolling back fails as well, a *RollbackError is returned.
+func (t *Transaction) Run() error {
+	return t.RunContext(context.Background())
+}
+
+// RunContext is Run with a context; if the context is done while a node is
+// blocked on its dependencies, the transaction aborts with a *BlockError
+func (t *Transaction) RunContext(ctx context.Context) error {
+	nodes, err := t.Nodes()
+	if err != nil {
+		return err
+	}
+	members := make(map[int]bool, len(nodes))
+	for _, n := range nodes {
+		members[n.ID()] = true
+	}
+
+	releases, err := t.acquire(ctx, nodes, members)
+	defer func() {
+		for i := len(releases) - 1; i >= 0; i-- {
+			releases[i]()
+		}
+	}()
+	if err != nil {
+		t.signal(nodes, Aborted)
+		return err
+	}
+
+	undo := NewUndoLog()
+	var failed DGNode
+	for _, s := range t.steps {
+		if err = undo.Record(s.procedure, sectionOf(s.node)); err != nil {
+			failed = s.node
+			break
+		}
+		if err = s.call(); err != nil {
+			failed = s.node
+			break
+		}
+	}
+	if err == nil {
+		for _, s := range t.steps {
+			if err = s.procedure.Commit(quiet(s.node)); err != nil {
+				failed = s.node
+				break
+			}
+		}
+	}
+
+	if err != nil {
+		if rerr := undo.Rollback(); rerr != nil {
+			err = &RollbackError{Node: failed.ID(), Err: err, Rollback: rerr}
+		}
+		t.signal(nodes, Aborted)
+		return err
+	}
+	undo.Commit()
+	t.signal(nodes, Completed)
+
+	return nil
+}
+
+// acquire blocks every node on its dependencies outside the transaction and
+// locks the spaces of the nodes (see lockOrder); returns the functions that release the spaces
+func (t *Transaction) acquire(ctx context.Context, nodes []DGNode, members map[int]bool) ([]func(), error) {
+	h := t.Handler
+	if h == nil {
+		h = CompletionPolicy()
+	}
+
+	// the signals of other nodes of the transaction only arrive once it is over
+	external := make(map[int]SignalsMap, len(nodes))
+	for _, n := range nodes {
+		external[n.ID()] = make(SignalsMap)
+		for id, c := range n.ListSignals() {
+			if members[id] {
+				go drain(c)
+				continue
+			}
+			external[n.ID()][id] = c
+		}
+	}
+
+	// a node's dependencies may signal their dependents in any order, so every
+	// node blocks at the same time; the first node that cannot proceed stops the others
+	wctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	errs := make(chan error, len(nodes))
+	for _, n := range nodes {
+		// a virtual node must be marked as started before it blocks,
+		// so that no new dependencies can be added to it
+		if v, ok := n.(Virtual); ok {
+			v.Start()
+		}
+
+		t.source.recordState(n.ID(), Waiting)
+		go func(n DGNode) {
+			err := await(wctx, txNode{n, external[n.ID()]}, h, t.source.watcher(), t.source)
+			if err != nil {
+				cancel()
+			}
+			errs <- err
+		}(n)
+	}
+	// the nodes stopped by the first one report a *BlockError
+	var first error
+	for range nodes {
+		err := <-errs
+		if _, blocked := first.(*BlockError); err != nil && (first == nil || blocked) {
+			first = err
+		}
+	}
+	if first != nil {
+		return nil, first
+	}
+
+	var releases []func()
+	if t.Locks == nil {
+		return releases, nil
+	}
+	for _, n := range lockOrder(t.spaces(), nodes) {
+		release, err := t.Locks.Lock(ctx, n)
+		if err != nil {
+			return releases, err
+		}
+		releases = append(releases, release)
+	}
+
+	return releases, nil
+}
+
+// signal signals the dependents of every node (once) and records its final state
+func (t *Transaction) signal(nodes []DGNode, value Signal) {
+	for _, n := range nodes {
+		t.source.finish(n, value)
+	}
+}
+
+// spaces returns the graph the spaces of the nodes are in (nil if unknown)
+func (t *Transaction) spaces() *Graph {
+	switch s := t.source.(type) {
+	case *Graph:
+		return s
+	case *VDG:
+		return s.Global
+	}
+	return nil
+}
+
+// lockOrder returns a node per distinct space of the nodes, in dependency
+// order of the spaces in g (every space after the spaces it depends on, with
+// the space id as the tie-break, see Levels; spaces that are not in g come last,
+// by id), so that every transaction locks shared spaces in the same order.
+// The node of a space is a writer if any node writes it, so that the space is
+// locked exclusively.
+func lockOrder(g *Graph, nodes []DGNode) []DGNode {
+	index := make(map[int]int)
+	var locks []DGNode
+	for _, n := range nodes {
+		space := spaceOf(n)
+		if space == nil {
+			continue
+		}
+		i, ok := index[space.ID()]
+		if !ok {
+			index[space.ID()] = len(locks)
+			locks = append(locks, n)
+			continue
+		}
+		if IsReader(locks[i]) && !IsReader(n) {
+			locks[i] = n
+		}
+	}
+
+	// space id -> position in the topological order of g
+	position := make(map[int]int)
+	if g != nil {
+		if order, err := g.TopologicalOrder(); err == nil {
+			for i, n := range order {
+				position[n.ID()] = i
+			}
+		}
+	}
+	sort.Slice(locks, func(i, j int) bool {
+		a, b := spaceOf(locks[i]).ID(), spaceOf(locks[j]).ID()
+		pa, inA := position[a]
+		pb, inB := position[b]
+		if inA != inB {
+			return inA
+		}
+		if inA {
+			return pa < pb
+		}
+		return a < b
+	})
+
+	return locks
+}
+
+// txNode is a node that only blocks on the given signals
+type txNode struct {
+	DGNode
+	signals SignalsMap
+}
+
+func (n txNode) ListSignals() SignalsMap {
+	return n.signals
+}
+
+// quiet wraps a node so that signals sent through it are dropped; the
+// wrapper keeps the node's kind, for Commit methods that convert it
+func quiet(n DGNode) DGNode {
+	switch v := n.(type) {
+	case Virtual:
+		return quietVirtual{v}
+	case UI:
+		return quietUI{v}
+	case Temporal:
+		return quietTemporal{v}
+	}
+	return quietNode{n}
+}
+
+type quietNode struct{ DGNode }
+
+func (quietNode) Signal(NodeSignal) {}
+
+type quietUI struct{ UI }
+
+func (quietUI) Signal(NodeSignal) {}
+
+type quietTemporal struct{ Temporal }
+
+func (quietTemporal) Signal(NodeSignal) {}
+
+type quietVirtual struct{ Virtual }
+
+func (quietVirtual) Signal(NodeSignal) {}
@@ -14,7 +14,7 @@ package fabric
 type UI interface {
 	DGNode
 	GetSection() Section
-	IsUnique() bool  // specifies whether a UI is *strictly* unique or not (a UI will always have totality-uniqueness)
+	IsUnique() bool  // specifies whether a UI is *strictly* unique or not (a UI will always have totality-uniqueness; see VerifyUniqueness)
 	IsVirtual() bool // specifies whether a UI is virtual or not
 }
 
@@ -0,0 +1,164 @@
+package fabric
+
+import (
+	"fmt"
+	"sync"
+)
+
+/*
+	Undo Logs
+
+	AccessType.Rollback takes the CDS nodes and edges to restore after an
+	operation failure, but the values to restore are the ones from *before*
+	the operation. An UndoLog captures them: before an access procedure
+	runs, Record snapshots the CDS nodes and edges it may write within its
+	Section (its write sets, see WriteSets), and Rollback replays the
+	snapshots through the procedures' Rollback methods (the last recorded
+	procedure first).
+
+	Every CDS node and edge in a write set must implement
+	NodeSnapshotter/EdgeSnapshotter and return a copy of itself: a node or
+	edge that is a pointer (or holds one) cannot be snapshotted by value, as
+	the copy would change along with the CDS. Record returns an error (and
+	records nothing) if one of them cannot be snapshotted.
+
+	Set an Executor's Undo to record an UndoLog for every node before its
+	function runs, and roll it back if the function fails.
+*/
+
+// NodeSnapshotter is implemented by CDS nodes that copy themselves for an UndoLog
+type NodeSnapshotter interface {
+	Snapshot() Node
+}
+
+// EdgeSnapshotter is implemented by CDS edges that copy themselves for an UndoLog
+type EdgeSnapshotter interface {
+	Snapshot() Edge
+}
+
+type undoEntry struct {
+	procedure AccessType
+	nodes     RestoreNodes
+	edges     RestoreEdges
+}
+
+// UndoLog records the pre-images of the CDS nodes and edges access procedures write
+type UndoLog struct {
+	mu      sync.Mutex
+	entries []undoEntry
+}
+
+// NewUndoLog ...
+func NewUndoLog() *UndoLog {
+	return &UndoLog{}
+}
+
+// Record snapshots the CDS nodes and edges of a section that an access procedure
+// may write; must be called before the procedure runs
+func (l *UndoLog) Record(at AccessType, s Section) error {
+	entry, err := snapshot(at, s)
+	if err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.entries = append(l.entries, entry)
+
+	return nil
+}
+
+// RecordNode records every access procedure of a node over the section the node
+// operates on (either all of them, or none if one cannot be snapshotted)
+func (l *UndoLog) RecordNode(n DGNode) error {
+	s := sectionOf(n)
+	var entries []undoEntry
+	for _, p := range n.ListProcedures() {
+		entry, err := snapshot(p, s)
+		if err != nil {
+			return err
+		}
+		entries = append(entries, entry)
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.entries = append(l.entries, entries...)
+
+	return nil
+}
+
+func snapshot(at AccessType, s Section) (undoEntry, error) {
+	nodes, edges := WriteSets(at, s)
+	entry := undoEntry{
+		procedure: at,
+		nodes:     make(RestoreNodes, len(nodes)),
+		edges:     make(RestoreEdges, len(edges)),
+	}
+	for i, n := range nodes {
+		sn, ok := n.(NodeSnapshotter)
+		if !ok {
+			return entry, fmt.Errorf("CDS node %d does not implement NodeSnapshotter. Cannot record it.", n.ID())
+		}
+		entry.nodes[i] = sn.Snapshot()
+	}
+	for i, e := range edges {
+		se, ok := e.(EdgeSnapshotter)
+		if !ok {
+			return entry, fmt.Errorf("CDS edge %d does not implement EdgeSnapshotter. Cannot record it.", e.ID())
+		}
+		entry.edges[i] = se.Snapshot()
+	}
+
+	return entry, nil
+}
+
+// Len returns the number of recorded procedures
+func (l *UndoLog) Len() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return len(l.entries)
+}
+
+// Commit discards the log (the recorded procedures will not be rolled back)
+func (l *UndoLog) Commit() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.entries = nil
+}
+
+// Rollback replays the snapshots through the Rollback method of every recorded
+// procedure (the last recorded procedure first), and empties the log.
+// Returns the first error of a Rollback; the remaining procedures are still rolled back.
+func (l *UndoLog) Rollback() error {
+	l.mu.Lock()
+	entries := l.entries
+	l.entries = nil
+	l.mu.Unlock()
+
+	var first error
+	for i := len(entries) - 1; i >= 0; i-- {
+		e := entries[i]
+		if err := e.procedure.Rollback(e.nodes, e.edges); err != nil && first == nil {
+			first = err
+		}
+	}
+
+	return first
+}
+
+// RollbackError is returned when a node failed, and rolling it back failed as well
+type RollbackError struct {
+	Node     int
+	Err      error // the error the node failed with
+	Rollback error // the error of the rollback
+}
+
+// Error ...
+func (e *RollbackError) Error() string {
+	return fmt.Sprintf("Node %d failed (%v) and could not be rolled back: %v", e.Node, e.Err, e.Rollback)
+}
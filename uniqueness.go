@@ -0,0 +1,126 @@
+package fabric
+
+/*
+	Uniqueness Verification
+
+	Every UI of a graph must be totality-unique: no two UIs of the same CDS
+	may address exactly the same Section (the same CDS nodes and edges).
+	A UI that reports IsUnique() is also strictly unique: its Section must
+	be disjoint from the Section of every other UI/VUI of the same CDS.
+
+	VerifyUniqueness checks both at the Section level (comparing CDS node
+	and edge ids, not whole DGNodes) and returns every conflicting pair of
+	UIs with the CDS nodes and edges they share. UIs without any CDS nodes
+	or edges address nothing, and never conflict.
+*/
+
+// UniquenessViolation is the kind of uniqueness a pair of UIs violates
+type UniquenessViolation int
+
+const (
+	// TotalityViolation is a pair of UIs that address the same Section
+	TotalityViolation UniquenessViolation = iota
+	// StrictViolation is a pair of overlapping UIs, one of which is strictly unique
+	StrictViolation
+)
+
+// String ...
+func (v UniquenessViolation) String() string {
+	if v == TotalityViolation {
+		return "totality"
+	}
+	return "strict"
+}
+
+// UniquenessConflict is a pair of UIs that violates uniqueness
+type UniquenessConflict struct {
+	A, B      int // node ids (A < B)
+	Violation UniquenessViolation
+	Nodes     []int // ids of the shared CDS nodes (sorted)
+	Edges     []int // ids of the shared CDS edges (sorted)
+}
+
+// sameSet reports whether two id sets are equal
+func sameSet(a, b map[int]struct{}) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for id := range a {
+		if _, ok := b[id]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// uniquenessConflicts returns the conflicts between the UI/VUI nodes of the
+// graph (sorted by A, then B); only the CDSs accepted by the filter are checked
+func (g *Graph) uniquenessConflicts(cds func(string) bool) []UniquenessConflict {
+	uis := g.spaces()
+	nodes := make([]map[int]struct{}, len(uis))
+	edges := make([]map[int]struct{}, len(uis))
+	for i, u := range uis {
+		nodes[i], edges[i] = sectionIDs(u.GetSection())
+	}
+
+	var list []UniquenessConflict
+	for i, a := range uis {
+		if !cds(CDSOf(a)) || len(nodes[i])+len(edges[i]) == 0 {
+			continue
+		}
+		for j := i + 1; j < len(uis); j++ {
+			b := uis[j]
+			if CDSOf(a) != CDSOf(b) {
+				continue
+			}
+			shared := UniquenessConflict{
+				A:     a.ID(),
+				B:     b.ID(),
+				Nodes: intersect(nodes[i], nodes[j]),
+				Edges: intersect(edges[i], edges[j]),
+			}
+			if len(shared.Nodes)+len(shared.Edges) == 0 {
+				continue
+			}
+
+			// totality-uniqueness only applies to (real) UIs
+			if a.GetType() == UINode && b.GetType() == UINode &&
+				sameSet(nodes[i], nodes[j]) && sameSet(edges[i], edges[j]) {
+				c := shared
+				c.Violation = TotalityViolation
+				list = append(list, c)
+			}
+			if a.IsUnique() || b.IsUnique() {
+				c := shared
+				c.Violation = StrictViolation
+				list = append(list, c)
+			}
+		}
+	}
+
+	return list
+}
+
+// VerifyUniqueness returns every pair of UIs of the graph that violates
+// totality-uniqueness or strict uniqueness (sorted by A, then B)
+func (g *Graph) VerifyUniqueness() []UniquenessConflict {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	return g.uniquenessConflicts(func(string) bool { return true })
+}
+
+// StrictlyUnique returns true if the Section of every UI that reports
+// IsUnique() is disjoint from the Sections of all other UIs of its CDS
+func (g *Graph) StrictlyUnique() bool {
+	return !hasViolation(g.VerifyUniqueness(), StrictViolation)
+}
+
+func hasViolation(conflicts []UniquenessConflict, v UniquenessViolation) bool {
+	for _, c := range conflicts {
+		if c.Violation == v {
+			return true
+		}
+	}
+	return false
+}
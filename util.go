@@ -10,15 +10,6 @@ func contains(s []DGNode, i DGNode) bool {
 	return false
 }
 
-func containsVirtual(s []Virtual, i Virtual) bool {
-	for _, v := range s {
-		if i.ID() == v.ID() {
-			return true
-		}
-	}
-	return false
-}
-
 // ContainsNode checks if a CDS node (reference) is in a NodeList
 func ContainsNode(l NodeList, n Node) bool {
 	for _, v := range l {
@@ -38,3 +29,71 @@ func ContainsEdge(l EdgeList, e Edge) bool {
 	}
 	return false
 }
+
+// copySignaling returns a copy of a SignalingMap, so that a node's
+// existing map is never mutated while it may be in use
+func copySignaling(sm SignalingMap) SignalingMap {
+	c := make(SignalingMap, len(sm))
+	for k, v := range sm {
+		c[k] = v
+	}
+	return c
+}
+
+// copySignals returns a copy of a SignalsMap, so that a node's
+// existing map is never mutated while it may be in use
+func copySignals(s SignalsMap) SignalsMap {
+	c := make(SignalsMap, len(s))
+	for k, v := range s {
+		c[k] = v
+	}
+	return c
+}
+
+// removeByID returns the DGNode slice without the node with the given id
+func removeByID(s []DGNode, id int) []DGNode {
+	for i, v := range s {
+		if v.ID() == id {
+			return append(s[:i:i], s[i+1:]...)
+		}
+	}
+	return s
+}
+
+// removeVirtualByID returns the Virtual slice without the node with the given id
+func removeVirtualByID(s []Virtual, id int) []Virtual {
+	for i, v := range s {
+		if v.ID() == id {
+			return append(s[:i:i], s[i+1:]...)
+		}
+	}
+	return s
+}
+
+// spaceOf returns the (V)UI a DGNode operates on (nil if it cannot be determined)
+func spaceOf(n DGNode) UI {
+	switch v := n.(type) {
+	case Virtual:
+		return v.Subspace()
+	case UI:
+		return v
+	case Temporal:
+		if roots := v.GetRoots(); len(roots) > 0 {
+			return roots[0]
+		}
+	}
+	return nil
+}
+
+// nodeSignal creates the signal a node sends to its dependents; the access
+// type is the node's first access procedure (if it has any)
+func nodeSignal(n DGNode, value Signal) NodeSignal {
+	s := NodeSignal{
+		Value: value,
+		Space: spaceOf(n),
+	}
+	if procedures := n.ListProcedures(); len(procedures) > 0 {
+		s.AccessType = procedures[0].ID()
+	}
+	return s
+}
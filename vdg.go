@@ -2,9 +2,7 @@ package fabric
 
 import (
 	"fmt"
-	"math/rand"
 	"sync"
-	"time"
 )
 
 // Virtual is the interface definition that virtual nodes in a VDG graph
@@ -131,11 +129,30 @@ func (r *Root) IsVirtual() bool {
 //		associated with different UIs).
 
 // VDG ...
+// A VDG follows the same concurrency model as a Graph: all methods are safe
+// for concurrent use, readers return snapshots, and Top and Space must not be
+// accessed directly while the VDG may be changed concurrently.
+// Lock order: a VDG may take the lock of its Global graph while holding its
+// own, never the other way round (Graph methods never take the lock of a VDG).
 type VDG struct {
 	Global *Graph // a reference to the real global graph of the system
 	Root   Virtual
 	Top    map[Virtual][]Virtual
 	Space  []int // the set of all (V)UI ids that at least one node in the VDG has access too
+
+	mu       sync.RWMutex
+	nodes    map[int]Virtual // node id -> node (the key used in Top)
+	adj      adjacency
+	acyclic  *topoOrder          // non-nil when cycle-forming edges are rejected
+	signals  SignalBackend       // creates the signaling channels of new edges (see SetSignalBackend)
+	channels *ChannelBackend     // the backend used when signals is not set (created lazily)
+	states   map[int]Signal      // node id -> last recorded state (see SetState)
+	images   map[int]image       // node id -> section before the node started (see restoreLists)
+	sending  map[int]int         // node id -> final signals being sent (see finish)
+	signaled map[int]bool        // nodes whose final signal an abort chain sent (see finish)
+	ids      IDAllocator         // used by NextID (nil means the allocator of the global graph)
+	watchdog *Watchdog           // tracks blocked nodes (see SetWatchdog)
+	compat   CompatibilityMatrix // which access classes commute (see SetCompatibility)
 }
 
 // NewVDG will return an empty VDG graph
@@ -145,6 +162,8 @@ func NewVDG(g *Graph) (*VDG, error) {
 		Global: g,
 		Top:    make(map[Virtual][]Virtual),
 		Space:  make([]int, 0),
+		nodes:  make(map[int]Virtual),
+		adj:    newAdjacency(),
 	}
 
 	// add to graph
@@ -174,6 +193,8 @@ func NewVDGWithRoot(g *Graph) (*VDG, error) {
 		Root:   ir,
 		Top:    make(map[Virtual][]Virtual),
 		Space:  make([]int, 0),
+		nodes:  make(map[int]Virtual),
+		adj:    newAdjacency(),
 	}
 
 	// add to graph
@@ -185,23 +206,83 @@ func NewVDGWithRoot(g *Graph) (*VDG, error) {
 	return v, nil
 }
 
-// GenID can generate a unique integer id for a VDG node
+// NewVDGWithAllocator will return an empty VDG graph that generates ids with the given allocator
+func NewVDGWithAllocator(g *Graph, ids IDAllocator) (*VDG, error) {
+	v, err := NewVDG(g)
+	v.ids = ids
+
+	return v, err
+}
+
+// GenID can generate a unique integer id for a VDG node (see NextID); it
+// panics if the allocator fails
 func (g *VDG) GenID() int {
-	rand.Seed(time.Now().UnixNano())
-	id := rand.Int()
-	for n := range g.Top {
-		if n.ID() == id {
-			id = g.GenID()
-		}
+	id, err := g.NextID()
+	if err != nil {
+		panic(err)
 	}
 	return id
 }
 
+// NextID returns the next id of the VDG's IDAllocator that is not in use in the VDG
+func (g *VDG) NextID() (int, error) {
+	// the global graph's allocator is read before the VDG's lock is taken
+	global := g.globalIDs()
+
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	ids := g.ids
+	if ids == nil {
+		ids = global
+	}
+
+	return nextID(ids, func(id int) bool {
+		_, ok := g.nodes[id]
+		return ok
+	})
+}
+
+// globalIDs returns the allocator of the global graph (if any)
+func (g *VDG) globalIDs() IDAllocator {
+	if g.Global == nil {
+		return nil
+	}
+	g.Global.mu.RLock()
+	defer g.Global.mu.RUnlock()
+
+	return g.Global.ids
+}
+
+// init lazily creates the adjacency index for VDGs that were not
+// created with NewVDG; must be called with the write lock held
+func (g *VDG) init() {
+	if g.Top == nil {
+		g.Top = make(map[Virtual][]Virtual)
+	}
+	if g.nodes == nil {
+		g.nodes = make(map[int]Virtual)
+		g.adj = newAdjacency()
+	}
+}
+
+// Node returns the virtual node with the given id, if it is in the VDG
+func (g *VDG) Node(id int) (Virtual, bool) {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	n, ok := g.nodes[id]
+	return n, ok
+}
+
 // CreateSignalers ...
 func (g *VDG) CreateSignalers(n Virtual) SignalingMap {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
 	sm := make(SignalingMap)
 
-	deps := g.Dependents(n)
+	deps := g.dependents(n)
 	for _, d := range deps {
 		c := make(chan NodeSignal)
 		sm[d.ID()] = c
@@ -212,13 +293,16 @@ func (g *VDG) CreateSignalers(n Virtual) SignalingMap {
 
 // Signals ...
 func (g *VDG) Signals(n Virtual) SignalsMap {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
 	sm := make(SignalsMap)
 
-	deps := g.Dependencies(n)
+	deps := g.dependencies(n)
 	for _, d := range deps {
 		channels := d.ListSignalers()
 		ch := channels[n.ID()]
-		sm[n.ID()] = ch
+		sm[d.ID()] = ch
 	}
 
 	return sm
@@ -227,35 +311,70 @@ func (g *VDG) Signals(n Virtual) SignalsMap {
 // TotalBlock is the most basic format for signal checking
 // (used when a node wants to simply totally-block all further operations until its dependencies have signaled)
 // as it only accepts a BasicSignalHandler it will not be a very powerful form of blocking (only use if lazy)
+// Deprecated: use Block with a SignalHandler (e.g. CompletionPolicy()) instead.
 func (g *VDG) TotalBlock(nodeID int, handler BasicSignalHandler) bool {
 	var wg sync.WaitGroup
 
-	for n := range g.Top {
-		if n.ID() == nodeID {
-			depSignals := n.ListSignals()
-			for _, channel := range depSignals {
-				wg.Add(1)
-				go handler(channel, wg)
-			}
-			break
+	// the signals are read under the lock, but the node must not hold
+	// the lock while it blocks
+	var depSignals SignalsMap
+	g.mu.RLock()
+	n, ok := g.nodes[nodeID]
+	if ok {
+		depSignals = n.ListSignals()
+	}
+	w := g.watchdog
+	g.mu.RUnlock()
+
+	if ok {
+		ids := make([]int, 0, len(depSignals))
+		for id := range depSignals {
+			ids = append(ids, id)
 		}
+		w.begin(n, g, ids)
+		defer w.end(nodeID)
+	}
+
+	g.recordState(nodeID, Waiting)
+	for _, channel := range depSignals {
+		wg.Add(1)
+		go handler(channel, &wg)
 	}
 
 	// Virtual Node blocks/spins
 	wg.Wait()
+	g.recordState(nodeID, Started)
 
 	return true
 }
 
+// Nodes returns a snapshot of all nodes in the VDG
+func (g *VDG) Nodes() []Virtual {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	list := make([]Virtual, 0, len(g.nodes))
+	for _, id := range g.adj.ids() {
+		list = append(list, g.nodes[id])
+	}
+
+	return list
+}
+
 // Dependents ...
 func (g *VDG) Dependents(n Virtual) []Virtual {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	return g.dependents(n)
+}
+
+func (g *VDG) dependents(n Virtual) []Virtual {
 	var list []Virtual
 
-	for i, v := range g.Top {
-		if i.ID() != n.ID() {
-			if containsVirtual(v, n) {
-				list = append(list, i)
-			}
+	for id := range g.adj.in[n.ID()] {
+		if id != n.ID() {
+			list = append(list, g.nodes[id])
 		}
 	}
 
@@ -264,12 +383,20 @@ func (g *VDG) Dependents(n Virtual) []Virtual {
 
 // Dependencies ...
 func (g *VDG) Dependencies(n Virtual) []Virtual {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	return g.dependencies(n)
+}
+
+func (g *VDG) dependencies(n Virtual) []Virtual {
 	var list []Virtual
 
-	v, ok := g.Top[n]
+	node, ok := g.nodes[n.ID()]
 	if !ok {
 		return list
 	}
+	v := g.Top[node]
 
 	for _, p := range v {
 		list = append(list, p)
@@ -280,72 +407,108 @@ func (g *VDG) Dependencies(n Virtual) []Virtual {
 
 // AddVirtualNode adds a node to a VDG
 func (g *VDG) AddVirtualNode(node Virtual) (Virtual, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
 	var ret Virtual
-	if _, ok := g.Top[node]; !ok {
-		g.Top[node] = []Virtual{}
-	} else {
-		return ret, fmt.Errorf("Node already exists in Dependency Graph.")
+	if err := g.addNode(node); err != nil {
+		return ret, err
 	}
-	// Add node's subspace to graph
-	g.Space = append(g.Space, node.Subspace().ID())
-	for n := range g.Top {
-		if n.ID() == node.ID() {
-			ret = n
-		}
-	}
-	return ret, nil
+
+	return node, nil
 }
 
-// AddTopNode will add a node to the VDG and create an edge pointing from the root node to it
-func (g *VDG) AddTopNode(node Virtual) error {
-	if _, ok := g.Top[node]; !ok {
-		g.Top[node] = []Virtual{}
-	} else {
+// addNode inserts a node into Top and the adjacency index, and adds
+// the node's subspace to the VDG
+func (g *VDG) addNode(node Virtual) error {
+	g.init()
+
+	if _, ok := g.nodes[node.ID()]; ok {
 		return fmt.Errorf("Node already exists in Dependency Graph.")
 	}
 
+	g.Top[node] = []Virtual{}
+	g.nodes[node.ID()] = node
+	g.adj.addNode(node.ID())
+	if g.acyclic != nil {
+		g.acyclic.addNode(node.ID())
+	}
+
 	// Add node's subspace to graph
 	g.Space = append(g.Space, node.Subspace().ID())
-	for n := range g.Top {
-		if n.ID() == node.ID() {
-			// Add edge from root node to our new node
-			root := g.Root
-			g.AddVirtualEdge(root.ID(), node)
-		}
-	}
+
 	return nil
 }
 
+// AddTopNode will add a node to the VDG and create an edge pointing from the root node to it.
+// The edge is only created once the root is a node of the VDG (see AddVirtualNode):
+// NewVDGWithRoot does not add it, as every top node would then block on signaling it.
+func (g *VDG) AddTopNode(node Virtual) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	var root Virtual
+	if g.Root != nil {
+		root = g.nodes[g.Root.ID()]
+	}
+	if root != nil && root.Started() {
+		return fmt.Errorf("Root node has already started. Cannot add top nodes.")
+	}
+	if err := g.addNode(node); err != nil {
+		return err
+	}
+
+	// Add edge from root node to our new node
+	if root == nil {
+		return nil
+	}
+	return g.addVirtualEdge(root.ID(), node)
+}
+
 // RemoveVirtualNode is for removing a single node from a VDG
 // It will also remove all edges that have the node as
 // the destination node of the edge. And it will remove the (V)UI
 // subspace if not required by any other node in the VDG.
+// Removal is refused while any dependent of the node may be waiting on it
+// (i.e. its state is Waiting, or was never recorded, see SetState).
 func (g *VDG) RemoveVirtualNode(n Virtual) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
 
-	for node, list := range g.Top {
-		if node.ID() == n.ID() {
-			if len(list) > 0 {
-				return fmt.Errorf("Virtual node still has dependencies. Cannot be deleted.")
-			}
-		}
+	node, ok := g.nodes[n.ID()]
+	if !ok {
+		return nil
 	}
 
-	delete(g.Top, n)
+	if len(g.adj.out[node.ID()]) > 0 {
+		return fmt.Errorf("Virtual node still has dependencies. Cannot be deleted.")
+	}
+	if waiting := g.waitingDependents(node.ID()); len(waiting) > 0 {
+		return fmt.Errorf("Node %d still has waiting dependents %v. Cannot be deleted.", node.ID(), waiting)
+	}
 
 	// remove all references (edges) to node in other nodes edge slices
-	for n1, l := range g.Top {
-		if containsVirtual(l, n) {
-			for j, k := range l {
-				if k.ID() == n.ID() {
-					l = append(l[:j], l[j+1:]...)
-					g.Top[n1] = l
-				}
-			}
-		}
+	// and signals maps
+	for d := range g.adj.in[node.ID()] {
+		g.removeEdge(g.nodes[d], node)
+	}
+
+	delete(g.Top, node)
+	delete(g.nodes, node.ID())
+	g.forget(node.ID())
+	ids := g.ids
+	if ids == nil {
+		// see the lock order of VDG
+		ids = g.globalIDs()
+	}
+	releaseID(ids, node.ID())
+	g.adj.removeNode(node.ID())
+	if g.acyclic != nil {
+		g.acyclic.removeNode(node.ID())
 	}
 
 	// Remove VUI subspace from VDG (if not subspace for another Virtual node)
-	id := n.Subspace().ID()
+	id := node.Subspace().ID()
 	remove := true
 	for i := range g.Top {
 		if i.Subspace().ID() == id {
@@ -365,91 +528,152 @@ func (g *VDG) RemoveVirtualNode(n Virtual) error {
 	return nil
 }
 
-// AddVirtualEdge adds an edge to a VDG
+// AddVirtualEdge adds an edge to a VDG (the source node becomes a dependent of d).
+// If the VDG rejects cycles (see RejectCycles) and the edge would create one,
+// no edge is added and a *CycleError is returned.
 func (g *VDG) AddVirtualEdge(source int, d Virtual) error {
-	for i, k := range g.Top {
-		if i.ID() == source {
-			if i.Started() {
-				return fmt.Errorf("Node has already started. Cannot add dependencies")
-			}
-			if !containsVirtual(k, d) {
-				k = append(k, d)
-				g.Top[i] = k
-
-				// update SignalingMap for destination
-				depSig := d.ListSignalers()
-				depS := d.ListSignals()
-				depSig[i.ID()] = make(chan NodeSignal)
-				d.UpdateSignaling(depSig, depS)
-
-				// update SignalsMap for source
-				signals := i.ListSignals()
-				signalers := i.ListSignalers()
-				for j, v := range d.ListSignalers() {
-					if j == i.ID() {
-						signals[d.ID()] = v
-						break
-					}
-				}
-				i.UpdateSignaling(signalers, signals)
-			}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	return g.addVirtualEdge(source, d)
+}
+
+func (g *VDG) addVirtualEdge(source int, dest Virtual) error {
+	g.init()
+	i, ok := g.nodes[source]
+	if !ok {
+		return fmt.Errorf("Source node does not exist in Dependency Graph.")
+	}
+	if i.Started() {
+		return fmt.Errorf("Node has already started. Cannot add dependencies")
+	}
+	d, ok := g.nodes[dest.ID()]
+	if !ok {
+		return fmt.Errorf("Destination node does not exist in Dependency Graph.")
+	}
+	if g.adj.hasEdge(source, d.ID()) {
+		return nil
+	}
+	if g.acyclic != nil {
+		if cycle := g.acyclic.insertEdge(g.adj, source, d.ID()); cycle != nil {
+			return &CycleError{Path: cycle}
 		}
 	}
 
+	g.Top[i] = append(g.Top[i], d)
+	g.adj.addEdge(source, d.ID())
+
+	// update SignalingMap for destination
+	send, recv := g.backend().Connect(d.ID(), i.ID())
+	depSig := copySignaling(d.ListSignalers())
+	depSig[i.ID()] = send
+	d.UpdateSignaling(depSig, d.ListSignals())
+
+	// update SignalsMap for source
+	signals := copySignals(i.ListSignals())
+	signals[d.ID()] = recv
+	i.UpdateSignaling(i.ListSignalers(), signals)
+
 	return nil
 }
 
-// RemoveVirtualEdge removes a single edge from the VDG
+// RemoveVirtualEdge removes a single edge (and its signaling channel) from the VDG
 // Useful for when a dependency node is not being removed but
 // the dependent node no longer requires it as a dependency.
 func (g *VDG) RemoveVirtualEdge(source int, d Virtual) {
-	for i, k := range g.Top {
-		if i.ID() == source {
-			for j, v := range k {
-				if v.ID() == d.ID() {
-					k = append(k[:j], k[j+1:]...)
-					g.Top[i] = k
-				}
-			}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	i, ok := g.nodes[source]
+	if !ok || !g.adj.hasEdge(source, d.ID()) {
+		return
+	}
+
+	g.removeEdge(i, g.nodes[d.ID()])
+}
+
+// waiting reports whether a virtual node may be blocked on its dependencies
+// (see Graph.waiting); must be called with the lock held
+func (g *VDG) waiting(id int) bool {
+	s, ok := g.states[id]
+	return !ok || s == Waiting
+}
+
+// blocked reports whether a virtual node is recorded as Waiting, i.e. it is blocked
+// on its dependencies (see Block); must be called with the lock held
+func (g *VDG) blocked(id int) bool {
+	s, ok := g.states[id]
+	return ok && s == Waiting
+}
+
+// waitingDependents returns the dependents of a virtual node that may be
+// waiting on it (sorted); must be called with the lock held
+func (g *VDG) waitingDependents(id int) []int {
+	var waiting []int
+	for _, d := range sortedSet(g.adj.in[id]) {
+		if g.waiting(d) {
+			waiting = append(waiting, d)
 		}
 	}
+	return waiting
+}
+
+// removeEdge removes the edge `source -> dest` from Top, the adjacency index
+// and both signaling maps, and retires its channel; must be called with the
+// write lock held
+func (g *VDG) removeEdge(source, dest Virtual) {
+	g.Top[source] = removeVirtualByID(g.Top[source], dest.ID())
+	g.adj.removeEdge(source.ID(), dest.ID())
+
+	// update SignalingMap for destination
+	depSig := copySignaling(dest.ListSignalers())
+	delete(depSig, source.ID())
+	dest.UpdateSignaling(depSig, dest.ListSignals())
+
+	// update SignalsMap for source
+	signals := copySignals(source.ListSignals())
+	delete(signals, dest.ID())
+	source.UpdateSignaling(source.ListSignalers(), signals)
+
+	g.backend().Disconnect(dest.ID(), source.ID())
 }
 
 // CycleDetect will check whether a graph has cycles or not
 func (g *VDG) CycleDetect() bool {
-	var seen []Virtual
-	var done []Virtual
+	return g.Cycle() != nil
+}
 
-	for i := range g.Top {
-		if !containsVirtual(done, i) {
-			result, d := g.cycleDfs(i, seen, done)
-			done = d
-			if result {
-				return true
-			}
-		}
+// Cycle returns a *CycleError describing one cycle in the VDG,
+// or nil if the VDG is acyclic
+func (g *VDG) Cycle() error {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	if cycle := g.adj.findCycle(); cycle != nil {
+		return &CycleError{Path: cycle}
 	}
-	return false
+
+	return nil
 }
 
-// Recursive Depth-First-Search; used for Cycle Detection
-func (g *VDG) cycleDfs(start Virtual, seen, done []Virtual) (bool, []Virtual) {
-	seen = append(seen, start)
-	adj := g.Top[start]
-	for _, v := range adj {
-		if containsVirtual(done, v) {
-			continue
-		}
+// RejectCycles turns on (or off) the rejection of cycle-forming edges:
+// while on, AddVirtualEdge refuses any edge that would create a cycle.
+// Turning it on fails with a *CycleError if the VDG already has a cycle.
+func (g *VDG) RejectCycles(enable bool) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
 
-		if containsVirtual(seen, v) {
-			return true, done
-		}
+	if !enable {
+		g.acyclic = nil
+		return nil
+	}
 
-		if result, done := g.cycleDfs(v, seen, done); result {
-			return true, done
-		}
+	g.init()
+	order, cycle := newTopoOrder(g.adj)
+	if cycle != nil {
+		return &CycleError{Path: cycle}
 	}
-	seen = seen[:len(seen)-1]
-	done = append(done, start)
-	return false, done
+	g.acyclic = order
+
+	return nil
 }
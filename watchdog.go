@@ -0,0 +1,400 @@
+package fabric
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+/*
+	Watchdog
+
+	A node that blocks on a dependency that never signals (e.g. a
+	dependency that never started, or a cycle of nodes waiting on each
+	other) hangs forever. A Watchdog tracks which nodes are waiting on which
+	dependencies, and reports:
+
+		Deadlock - a cycle of nodes that are all waiting on each other
+		Stall    - a node that has been waiting for longer than the
+		           threshold; the reported chain follows what it is waiting
+		           on down to the first node that is not waiting itself
+		           (usually the culprit)
+
+	A Watchdog is attached to a Graph or VDG with SetWatchdog: nodes that
+	block with Block, BlockContext, TotalBlock or an Executor are tracked.
+	Nodes that are not part of a graph can block with the Watchdog's own
+	Await/AwaitContext.
+
+	Check runs the detection once; Start runs it periodically until Stop.
+	Every deadlock and stall is only reported once (until the nodes involved
+	stop waiting).
+*/
+
+// WatchdogEvent is the kind of problem a Watchdog reports
+type WatchdogEvent int
+
+const (
+	// Deadlock is a cycle of nodes waiting on each other
+	Deadlock WatchdogEvent = iota
+	// Stall is a node that has been waiting for longer than the threshold
+	Stall
+)
+
+// String ...
+func (e WatchdogEvent) String() string {
+	if e == Deadlock {
+		return "deadlock"
+	}
+	return "stall"
+}
+
+// BlockedNode describes a node in a blocked chain
+type BlockedNode struct {
+	ID          int
+	Type        NodeType // Unknown if the node could not be resolved
+	AccessTypes []int    // ids of the node's access procedures
+	Waiting     bool     // whether the node is itself waiting on dependencies
+	Since       time.Time
+	WaitingOn   []int // outstanding dependencies (sorted)
+}
+
+// WatchdogReport describes a deadlock or a stall
+type WatchdogReport struct {
+	Event WatchdogEvent
+	Chain []BlockedNode // each node waits on the next one (for a deadlock, the last waits on the first)
+}
+
+// String ...
+func (r WatchdogReport) String() string {
+	ids := make([]string, len(r.Chain))
+	for i, n := range r.Chain {
+		ids[i] = fmt.Sprintf("%d (%s, access types %v)", n.ID, n.Type, n.AccessTypes)
+	}
+
+	return fmt.Sprintf("%s: %s", r.Event, strings.Join(ids, " -> "))
+}
+
+// nodeSource resolves node ids for a Watchdog
+type nodeSource interface {
+	lookup(id int) (DGNode, bool)
+}
+
+type wait struct {
+	node        DGNode
+	src         nodeSource
+	since       time.Time
+	outstanding map[int]struct{}
+}
+
+// Watchdog detects deadlocks and stalls of blocked nodes
+type Watchdog struct {
+	Threshold time.Duration        // how long a node may wait before it is reported as stalled (0 disables stalls)
+	Interval  time.Duration        // how often Start checks (defaults to Threshold, or a second)
+	Report    func(WatchdogReport) // called for every new deadlock or stall
+
+	mu       sync.Mutex
+	waits    map[int]*wait   // waiting node id -> wait
+	reported map[string]bool // keys of the problems already reported
+	stop     chan struct{}
+}
+
+// NewWatchdog ...
+func NewWatchdog(threshold time.Duration, report func(WatchdogReport)) *Watchdog {
+	return &Watchdog{
+		Threshold: threshold,
+		Report:    report,
+		waits:     make(map[int]*wait),
+		reported:  make(map[string]bool),
+	}
+}
+
+// begin tracks a node that starts waiting on the given dependencies
+func (w *Watchdog) begin(n DGNode, src nodeSource, dependencies []int) {
+	if w == nil {
+		return
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.waits == nil {
+		w.waits = make(map[int]*wait)
+		w.reported = make(map[string]bool)
+	}
+	outstanding := make(map[int]struct{}, len(dependencies))
+	for _, d := range dependencies {
+		outstanding[d] = struct{}{}
+	}
+	w.waits[n.ID()] = &wait{node: n, src: src, since: time.Now(), outstanding: outstanding}
+}
+
+// release tracks a dependency that no longer holds a node back
+func (w *Watchdog) release(node, dependency int) {
+	if w == nil {
+		return
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if wt, ok := w.waits[node]; ok {
+		delete(wt.outstanding, dependency)
+	}
+}
+
+// end tracks a node that stopped waiting
+func (w *Watchdog) end(node int) {
+	if w == nil {
+		return
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	delete(w.waits, node)
+}
+
+// Await blocks a node like Await, while the Watchdog tracks it
+func (w *Watchdog) Await(n DGNode, h SignalHandler) error {
+	return awaitContext(context.Background(), n, h, w, nil)
+}
+
+// AwaitContext blocks a node like AwaitContext, while the Watchdog tracks it
+func (w *Watchdog) AwaitContext(ctx context.Context, n DGNode, h SignalHandler) error {
+	return awaitContext(ctx, n, h, w, nil)
+}
+
+// Waiting returns the ids of the nodes that are currently waiting (sorted)
+func (w *Watchdog) Waiting() []int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	ids := make([]int, 0, len(w.waits))
+	for id := range w.waits {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+
+	return ids
+}
+
+// Check detects deadlocks and stalls, reports the new ones through Report,
+// and returns all current ones
+func (w *Watchdog) Check() []WatchdogReport {
+	reports, fresh := w.check()
+	if w.Report != nil {
+		for _, r := range fresh {
+			w.Report(r)
+		}
+	}
+
+	return reports
+}
+
+// check returns all current problems, and the ones that were not reported yet
+func (w *Watchdog) check() ([]WatchdogReport, []WatchdogReport) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	var reports []WatchdogReport
+	inCycle := make(map[int]bool)
+
+	// wait-for graph: waiting node -> outstanding dependencies
+	a := newAdjacency()
+	for id, wt := range w.waits {
+		a.addNode(id)
+		for d := range wt.outstanding {
+			a.addNode(d)
+			a.addEdge(id, d)
+		}
+	}
+	for {
+		cycle := a.findCycle()
+		if cycle == nil {
+			break
+		}
+		var chain []BlockedNode
+		for _, id := range cycle {
+			chain = append(chain, w.describe(id, nil))
+			inCycle[id] = true
+		}
+		reports = append(reports, WatchdogReport{Event: Deadlock, Chain: chain})
+		// look for other cycles
+		for _, id := range cycle {
+			a.removeNode(id)
+		}
+	}
+
+	if w.Threshold > 0 {
+		now := time.Now()
+		ids := make([]int, 0, len(w.waits))
+		for id := range w.waits {
+			ids = append(ids, id)
+		}
+		sort.Ints(ids)
+
+		for _, id := range ids {
+			wt := w.waits[id]
+			if inCycle[id] || now.Sub(wt.since) < w.Threshold {
+				continue
+			}
+			reports = append(reports, WatchdogReport{Event: Stall, Chain: w.chain(id)})
+		}
+	}
+
+	// only report new problems, and forget the ones that are gone
+	var fresh []WatchdogReport
+	current := make(map[string]bool, len(reports))
+	for _, r := range reports {
+		key := reportKey(r)
+		current[key] = true
+		if !w.reported[key] {
+			fresh = append(fresh, r)
+		}
+	}
+	w.reported = current
+
+	return reports, fresh
+}
+
+// chain follows the lowest outstanding dependency from a waiting node until
+// a node that is not waiting (or a node already in the chain)
+func (w *Watchdog) chain(id int) []BlockedNode {
+	var chain []BlockedNode
+	seen := make(map[int]bool)
+	var src nodeSource
+	for !seen[id] {
+		seen[id] = true
+		n := w.describe(id, src)
+		chain = append(chain, n)
+
+		wt, ok := w.waits[id]
+		if !ok || len(n.WaitingOn) == 0 {
+			break
+		}
+		src = wt.src
+		id = n.WaitingOn[0]
+	}
+
+	return chain
+}
+
+// describe returns the BlockedNode for an id; nodes that are not waiting are
+// resolved with the source of the node waiting on them
+func (w *Watchdog) describe(id int, src nodeSource) BlockedNode {
+	b := BlockedNode{ID: id, Type: Unknown}
+
+	var n DGNode
+	if wt, ok := w.waits[id]; ok {
+		n = wt.node
+		b.Waiting = true
+		b.Since = wt.since
+		b.WaitingOn = sortedSet(wt.outstanding)
+	} else if src != nil {
+		n, _ = src.lookup(id)
+	}
+
+	if n != nil {
+		b.Type = n.GetType()
+		for _, p := range n.ListProcedures() {
+			b.AccessTypes = append(b.AccessTypes, p.ID())
+		}
+	}
+
+	return b
+}
+
+func reportKey(r WatchdogReport) string {
+	ids := make([]string, len(r.Chain))
+	for i, n := range r.Chain {
+		ids[i] = fmt.Sprint(n.ID)
+	}
+	return fmt.Sprintf("%s:%s", r.Event, strings.Join(ids, ","))
+}
+
+// Start runs Check periodically until Stop is called
+func (w *Watchdog) Start() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.stop != nil {
+		return
+	}
+	interval := w.Interval
+	if interval <= 0 {
+		interval = w.Threshold
+	}
+	if interval <= 0 {
+		interval = time.Second
+	}
+	stop := make(chan struct{})
+	w.stop = stop
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				w.Check()
+			case <-stop:
+				return
+			}
+		}
+	}()
+}
+
+// Stop stops the periodic checks started by Start
+func (w *Watchdog) Stop() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.stop != nil {
+		close(w.stop)
+		w.stop = nil
+	}
+}
+
+// SetWatchdog attaches a Watchdog to the graph (nil detaches it)
+func (g *Graph) SetWatchdog(w *Watchdog) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.watchdog = w
+}
+
+func (g *Graph) watcher() *Watchdog {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	return g.watchdog
+}
+
+// lookup ...
+func (g *Graph) lookup(id int) (DGNode, bool) {
+	return g.Node(id)
+}
+
+// SetWatchdog attaches a Watchdog to the VDG (nil detaches it)
+func (g *VDG) SetWatchdog(w *Watchdog) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.watchdog = w
+}
+
+func (g *VDG) watcher() *Watchdog {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	return g.watchdog
+}
+
+// lookup ...
+func (g *VDG) lookup(id int) (DGNode, bool) {
+	n, ok := g.Node(id)
+	if !ok {
+		return nil, false
+	}
+	return n, true
+}